@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/caarlos0/env/v6"
+	"github.com/google/uuid"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/signal"
+	"pingr"
+	"pingr/internal/bus"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// pingr-agent runs the tests assigned to its location, as configured for its token in pingrd,
+// and reports the results back to pingrd
+type config struct {
+	PingrUrl     string        `env:"PINGR_URL,required"` // e.g. https://pingr.domain.com
+	Token        string        `env:"AGENT_TOKEN,required"`
+	SyncInterval time.Duration `env:"SYNC_INTERVAL" envDefault:"1m"` // how often the assigned tests are fetched
+	Dev          bool          `env:"DEV" envDefault:"false"`
+}
+
+const maxPending = 10000 // results kept while pingrd can't be reached
+
+type agent struct {
+	cfg    config
+	client *http.Client
+	buz    *bus.Bus
+
+	workers map[string]worker
+	wg      sync.WaitGroup
+
+	results chan pingr.AgentResult
+}
+
+type worker struct {
+	data   []byte // the test as last fetched, the worker is restarted when it changes
+	cancel context.CancelFunc
+}
+
+func main() {
+	var cfg config
+	if err := env.Parse(&cfg); err != nil {
+		log.Fatal("Couldn't parse config from env: ", err)
+	}
+	if cfg.Dev {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetFormatter(&log.JSONFormatter{})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+		<-signals
+		log.Info("Got SIGINT/SIGTERM, exiting..")
+		cancel()
+	}()
+
+	a := &agent{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		buz:     bus.New(),
+		workers: make(map[string]worker),
+		results: make(chan pingr.AgentResult, 100),
+	}
+
+	reported := make(chan struct{})
+	go func() {
+		a.report(ctx)
+		close(reported)
+	}()
+
+	log.Info("Starting pingr-agent")
+	for {
+		err := a.sync(ctx)
+		if err != nil {
+			log.Error("could not sync tests: ", err)
+		}
+		select {
+		case <-time.After(cfg.SyncInterval):
+		case <-ctx.Done():
+			a.wg.Wait()
+			<-reported
+			log.Info("Terminating agent")
+			return
+		}
+	}
+}
+
+// sync fetches the assigned tests, starting workers for new or changed tests and stopping the unassigned
+func (a *agent) sync(ctx context.Context) error {
+	req, err := a.request(ctx, "GET", "/api/agent/tests", nil)
+	if err != nil {
+		return err
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tests []pingr.GenericTest
+	err = json.NewDecoder(res.Body).Decode(&tests)
+	if err != nil {
+		return err
+	}
+
+	assigned := map[string]bool{}
+	for _, test := range tests {
+		assigned[test.TestId] = true
+		data, err := json.Marshal(test)
+		if err != nil {
+			return err
+		}
+		if w, ok := a.workers[test.TestId]; ok {
+			if bytes.Equal(w.data, data) {
+				continue
+			}
+			w.cancel()
+		}
+
+		wctx, cancel := context.WithCancel(ctx)
+		a.workers[test.TestId] = worker{data: data, cancel: cancel}
+		a.wg.Add(1)
+		go func(test pingr.GenericTest) {
+			defer a.wg.Done()
+			a.work(wctx, test)
+		}(test)
+		log.Info(fmt.Sprintf("TestID: %s, Test started", test.TestId))
+	}
+	for testId, w := range a.workers {
+		if !assigned[testId] {
+			w.cancel()
+			delete(a.workers, testId)
+			log.Info(fmt.Sprintf("TestID: %s, Test stopped", testId))
+		}
+	}
+	return nil
+}
+
+// work runs the test on its schedule until the context is done
+func (a *agent) work(ctx context.Context, test pingr.GenericTest) {
+	interval := test.Interval * time.Second
+	for {
+		if test.Cron != "" {
+			sched, err := test.Schedule()
+			if err != nil {
+				log.Error(fmt.Sprintf("TestID: %s, invalid schedule: %v", test.TestId, err))
+				return
+			}
+			if !sleep(ctx, time.Until(sched.Next(time.Now()))) {
+				return
+			}
+		}
+		if test.HasWindow() {
+			window, err := test.Window()
+			if err != nil {
+				log.Error(fmt.Sprintf("TestID: %s, invalid active window: %v", test.TestId, err))
+				return
+			}
+			if !sleep(ctx, time.Until(window.Next(time.Now()))) {
+				return
+			}
+		}
+
+		r := a.run(ctx, test, 0)
+		for attempt := 1; r.Error != "" && attempt <= int(test.Retries); attempt++ {
+			if !sleep(ctx, test.RetryDelay*time.Second) {
+				return
+			}
+			r = a.run(ctx, test, attempt)
+		}
+		select {
+		case a.results <- r:
+		case <-ctx.Done():
+			return
+		}
+
+		interval = test.NextInterval(interval, r.Error != "")
+		if !sleep(ctx, interval) {
+			return
+		}
+	}
+}
+
+func (a *agent) run(ctx context.Context, test pingr.GenericTest, attempt int) pingr.AgentResult {
+	ctx, cancel := context.WithTimeout(ctx, test.Deadline())
+	defer cancel()
+
+	var rt time.Duration
+	var err error
+	if attempt == 0 {
+		rt, err = test.RunTest(ctx, a.buz)
+	} else {
+		rt, err = test.RetryTest(ctx, a.buz, attempt)
+	}
+
+	r := pingr.AgentResult{
+		ResultId:     uuid.New().String(),
+		TestId:       test.TestId,
+		ResponseTime: rt,
+		TimedOut:     ctx.Err() == context.DeadlineExceeded,
+		CreatedAt:    time.Now(),
+	}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	log.Debug(fmt.Sprintf("TestID: %s, Error: %s", r.TestId, r.Error))
+	return r
+}
+
+// report sends the results to pingrd, keeping them until they have been received
+func (a *agent) report(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	var pending []pingr.AgentResult
+	for {
+		select {
+		case r := <-a.results:
+			pending = append(pending, r)
+			continue // Send the results in batches
+		case <-ticker.C:
+		case <-ctx.Done():
+			// Last attempt to send what has not yet been sent
+			sendCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			_ = a.send(sendCtx, pending)
+			cancel()
+			return
+		}
+		if len(pending) == 0 {
+			continue
+		}
+
+		err := a.send(ctx, pending)
+		if err != nil {
+			log.Error("could not report results: ", err)
+			if len(pending) > maxPending {
+				pending = pending[len(pending)-maxPending:]
+			}
+			continue
+		}
+		pending = nil
+	}
+}
+
+func (a *agent) send(ctx context.Context, results []pingr.AgentResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(results)
+	if err != nil {
+		return err
+	}
+	req, err := a.request(ctx, "POST", "/api/agent/results", body)
+	if err != nil {
+		return err
+	}
+	res, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		body, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("unexpected status %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (a *agent) request(ctx context.Context, method string, path string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(a.cfg.PingrUrl, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+a.cfg.Token)
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// sleep returns false if the context is done before d has passed
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
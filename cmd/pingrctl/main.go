@@ -0,0 +1,401 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/caarlos0/env/v6"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// pingrctl is a command-line client for the REST API of pingrd
+type config struct {
+	PingrUrl string `env:"PINGR_URL" envDefault:"http://localhost"` // e.g. https://pingr.domain.com
+	User     string `env:"PINGR_USER"`
+	Pass     string `env:"PINGR_PASS"`
+	Token    string `env:"PINGR_TOKEN"` // API token, used instead of basic auth if set
+}
+
+const usage = `Usage: pingrctl [-o table|json|yaml] <command> [arguments]
+
+Commands:
+  tests list [-tag <tag>]...    List tests, having all of the tags
+  tests status [-tag <tag>]...  List tests with their latest status
+  tests get <test-id>
+  tests create -f <file>        Create a test from a JSON or YAML file, - for stdin
+  tests update -f <file>        Update the test with the test_id of the file
+  tests delete <test-id>
+  tests pause <test-id>
+  tests resume <test-id>
+  tests run <test-id>           Run a stored test right away
+  tests try -f <file>           Run a test once without storing it
+  contacts list
+  contacts get <contact-id>
+  contacts create -f <file>
+  contacts update -f <file>
+  contacts delete <contact-id>
+  logs [-n <lines>] [-f] <test-id>  Show the latest logs of a test, -f to follow
+  incidents list [-active]
+
+Environment:
+  PINGR_URL   pingrd, e.g. https://pingr.domain.com
+  PINGR_USER  basic auth user
+  PINGR_PASS  basic auth password
+  PINGR_TOKEN API token, used instead of basic auth
+`
+
+type client struct {
+	cfg    config
+	http   *http.Client
+	output string
+
+	minWidth int // of table cells, for the columns of rows printed separately to line up
+}
+
+func main() {
+	var cfg config
+	if err := env.Parse(&cfg); err != nil {
+		fail("Couldn't parse config from env: %v", err)
+	}
+
+	flags := flag.NewFlagSet("pingrctl", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	output := flags.String("o", "table", "output format, table, json or yaml")
+	_ = flags.Parse(os.Args[1:])
+	switch *output {
+	case "table", "json", "yaml":
+	default:
+		fail("unknown output format %q", *output)
+	}
+
+	c := &client{
+		cfg:    cfg,
+		http:   &http.Client{Timeout: 5 * time.Minute}, // tests run on request may wait for a free slot
+		output: *output,
+	}
+
+	args := flags.Args()
+	if len(args) < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	var err error
+	switch args[0] {
+	case "tests":
+		err = c.tests(args[1:])
+	case "contacts":
+		err = c.contacts(args[1:])
+	case "logs":
+		err = c.logs(args[1:])
+	case "incidents":
+		err = c.incidents(args[1:])
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fail("%v", err)
+	}
+}
+
+func (c *client) tests(args []string) error {
+	cmd, args := command(args)
+	switch cmd {
+	case "list", "status":
+		var tags multiFlag
+		flags := flag.NewFlagSet("tests "+cmd, flag.ExitOnError)
+		flags.Var(&tags, "tag", "only tests with the tag, repeated for tests with all of the tags")
+		_ = flags.Parse(args)
+		q := url.Values{"tag": tags}
+		path := "/api/tests"
+		columns := testColumns
+		if cmd == "status" {
+			path = "/api/tests/status"
+			columns = statusColumns
+		}
+		return c.print("GET", path+"?"+q.Encode(), nil, columns)
+	case "get":
+		id, err := arg(args, "test-id")
+		if err != nil {
+			return err
+		}
+		return c.print("GET", "/api/tests/"+url.PathEscape(id), nil, testColumns)
+	case "create", "update", "try":
+		body, err := fileFlag("tests "+cmd, args)
+		if err != nil {
+			return err
+		}
+		method, path := "POST", "/api/tests"
+		switch cmd {
+		case "update":
+			method = "PUT"
+		case "try":
+			path = "/api/tests/test"
+		}
+		return c.print(method, path, body, testColumns)
+	case "delete":
+		return c.action("DELETE", "/api/tests/%s", args)
+	case "pause":
+		return c.action("PUT", "/api/tests/%s/deactivate", args)
+	case "resume":
+		return c.action("PUT", "/api/tests/%s/activate", args)
+	case "run":
+		id, err := arg(args, "test-id")
+		if err != nil {
+			return err
+		}
+		return c.print("POST", "/api/tests/"+url.PathEscape(id)+"/run", nil, logColumns)
+	}
+	return fmt.Errorf("unknown command: tests %s", cmd)
+}
+
+func (c *client) contacts(args []string) error {
+	cmd, args := command(args)
+	switch cmd {
+	case "list":
+		return c.print("GET", "/api/contacts", nil, contactColumns)
+	case "get":
+		id, err := arg(args, "contact-id")
+		if err != nil {
+			return err
+		}
+		return c.print("GET", "/api/contacts/"+url.PathEscape(id), nil, contactColumns)
+	case "create", "update":
+		body, err := fileFlag("contacts "+cmd, args)
+		if err != nil {
+			return err
+		}
+		method := "POST"
+		if cmd == "update" {
+			method = "PUT"
+		}
+		return c.print(method, "/api/contacts", body, contactColumns)
+	case "delete":
+		return c.action("DELETE", "/api/contacts/%s", args)
+	}
+	return fmt.Errorf("unknown command: contacts %s", cmd)
+}
+
+// logs prints the latest logs of a test, oldest first, and when following, the logs added since every other second
+func (c *client) logs(args []string) error {
+	flags := flag.NewFlagSet("logs", flag.ExitOnError)
+	n := flags.Int("n", 10, "number of logs to show")
+	follow := flags.Bool("f", false, "follow the logs of the test")
+	_ = flags.Parse(args)
+	id, err := arg(flags.Args(), "test-id")
+	if err != nil {
+		return err
+	}
+
+	if *follow {
+		c.minWidth = 14
+	}
+
+	var after float64
+	limit := *n
+	for {
+		q := url.Values{
+			"after": {fmt.Sprintf("%.0f", after)},
+			"limit": {fmt.Sprint(limit)},
+		}
+		data, err := c.do("GET", "/api/tests/"+url.PathEscape(id)+"/logs?"+q.Encode(), nil)
+		if err != nil {
+			return err
+		}
+		var logs []interface{}
+		err = json.Unmarshal(data, &logs)
+		if err != nil {
+			return err
+		}
+
+		// Newest first from the API
+		for i, j := 0, len(logs)-1; i < j; i, j = i+1, j-1 {
+			logs[i], logs[j] = logs[j], logs[i]
+		}
+		if len(logs) > 0 || after == 0 {
+			err = c.write(logs, logColumns, after == 0 || c.output != "table")
+			if err != nil {
+				return err
+			}
+		}
+		if len(logs) > 0 {
+			after, _ = logs[len(logs)-1].(map[string]interface{})["log_id"].(float64)
+		}
+
+		if !*follow {
+			return nil
+		}
+		limit = -1
+		time.Sleep(2 * time.Second)
+	}
+}
+
+func (c *client) incidents(args []string) error {
+	cmd, args := command(args)
+	if cmd != "list" {
+		return fmt.Errorf("unknown command: incidents %s", cmd)
+	}
+	flags := flag.NewFlagSet("incidents list", flag.ExitOnError)
+	active := flags.Bool("active", false, "only active incidents")
+	_ = flags.Parse(args)
+
+	data, err := c.do("GET", "/api/incidents", nil)
+	if err != nil {
+		return err
+	}
+	var incidents []interface{}
+	err = json.Unmarshal(data, &incidents)
+	if err != nil {
+		return err
+	}
+	if *active {
+		filtered := []interface{}{}
+		for _, i := range incidents {
+			if a, _ := i.(map[string]interface{})["active"].(bool); a {
+				filtered = append(filtered, i)
+			}
+		}
+		incidents = filtered
+	}
+	return c.write(incidents, incidentColumns, true)
+}
+
+// action requests a path with the id given as argument, printing the response
+func (c *client) action(method string, pathFormat string, args []string) error {
+	id, err := arg(args, "id")
+	if err != nil {
+		return err
+	}
+	data, err := c.do(method, fmt.Sprintf(pathFormat, url.PathEscape(id)), nil)
+	if err != nil {
+		return err
+	}
+	fmt.Println(strings.TrimSpace(string(data)))
+	return nil
+}
+
+// print requests the path and prints the response in the output format, responses that are not JSON as they are
+func (c *client) print(method string, path string, body []byte, columns []column) error {
+	data, err := c.do(method, path, body)
+	if err != nil {
+		return err
+	}
+	var v interface{}
+	if json.Unmarshal(data, &v) != nil {
+		fmt.Println(strings.TrimSpace(string(data)))
+		return nil
+	}
+	return c.write(v, columns, true)
+}
+
+func (c *client) do(method string, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, strings.TrimRight(c.cfg.PingrUrl, "/")+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c.cfg.Token != "":
+		req.Header.Set("Authorization", "Bearer "+c.cfg.Token)
+	case c.cfg.User != "" || c.cfg.Pass != "":
+		req.SetBasicAuth(c.cfg.User, c.cfg.Pass)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("%s %s: %d: %s", method, path, res.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// fileFlag reads the JSON, or YAML, file given with -f and returns it as JSON
+func fileFlag(name string, args []string) ([]byte, error) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	file := flags.String("f", "", "JSON or YAML file, - for stdin")
+	_ = flags.Parse(args)
+	if *file == "" {
+		return nil, fmt.Errorf("%s: missing -f <file>", name)
+	}
+
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(*file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is a subset of YAML
+	var v interface{}
+	err = yaml.Unmarshal(data, &v)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", *file, err)
+	}
+	return json.Marshal(toJSON(v))
+}
+
+// toJSON converts the maps decoded from YAML, keyed by interface{}, to maps that can be marshalled as JSON
+func toJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = toJSON(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = toJSON(e)
+		}
+		return v
+	}
+	return v
+}
+
+func command(args []string) (string, []string) {
+	if len(args) == 0 {
+		return "", nil
+	}
+	return args[0], args[1:]
+}
+
+func arg(args []string, name string) (string, error) {
+	if len(args) != 1 || args[0] == "" {
+		return "", fmt.Errorf("expected <%s>", name)
+	}
+	return args[0], nil
+}
+
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multiFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+func fail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "pingrctl: "+format+"\n", args...)
+	os.Exit(1)
+}
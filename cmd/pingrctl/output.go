@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v2"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+type column struct {
+	title  string
+	key    string
+	format func(interface{}) string // fmt.Sprint if nil
+}
+
+var testColumns = []column{
+	{title: "ID", key: "test_id"},
+	{title: "NAME", key: "test_name"},
+	{title: "TYPE", key: "test_type"},
+	{title: "URL", key: "url"},
+	{title: "INTERVAL", key: "interval", format: seconds},
+	{title: "ACTIVE", key: "active"},
+	{title: "TAGS", key: "tags", format: list},
+}
+
+var statusColumns = []column{
+	{title: "ID", key: "test_id"},
+	{title: "NAME", key: "test_name"},
+	{title: "TYPE", key: "test_type"},
+	{title: "ACTIVE", key: "active"},
+	{title: "STATUS", key: "status_id", format: status},
+	{title: "RESPONSE TIME", key: "response_time", format: duration},
+	{title: "TAGS", key: "tags", format: list},
+}
+
+var logColumns = []column{
+	{title: "TIME", key: "created_at", format: timestamp},
+	{title: "STATUS", key: "status_id", format: status},
+	{title: "RESPONSE TIME", key: "response_time", format: duration},
+	{title: "LOCATION", key: "location"},
+	{title: "MESSAGE", key: "message"},
+}
+
+var contactColumns = []column{
+	{title: "ID", key: "contact_id"},
+	{title: "NAME", key: "contact_name"},
+	{title: "TYPE", key: "contact_type"},
+	{title: "URL", key: "contact_url"},
+}
+
+var incidentColumns = []column{
+	{title: "ID", key: "incident_id"},
+	{title: "TEST", key: "test_name"},
+	{title: "ACTIVE", key: "active"},
+	{title: "CREATED", key: "created_at", format: timestamp},
+	{title: "ROOT CAUSE", key: "root_cause"},
+}
+
+// Same as the status_map table of pingrd
+var statusNames = map[float64]string{
+	1:  "Successful",
+	2:  "Error",
+	3:  "TimedOut",
+	5:  "Initialized",
+	6:  "Paused",
+	7:  "Retried",
+	8:  "Inactive",
+	9:  "Maintenance",
+	10: "Flapping",
+	11: "Degraded",
+}
+
+// write prints a JSON value, an object or a list of objects, in the output format
+func (c *client) write(v interface{}, columns []column, header bool) error {
+	switch c.output {
+	case "json":
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+		return nil
+	case "yaml":
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(data))
+		return nil
+	}
+
+	var rows []interface{}
+	switch v := v.(type) {
+	case []interface{}:
+		rows = v
+	case map[string]interface{}:
+		rows = []interface{}{v}
+	default:
+		fmt.Println(v)
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, c.minWidth, 0, 2, ' ', 0)
+	if header {
+		var titles []string
+		for _, col := range columns {
+			titles = append(titles, col.title)
+		}
+		fmt.Fprintln(w, strings.Join(titles, "\t"))
+	}
+	for _, row := range rows {
+		obj, _ := row.(map[string]interface{})
+		var cells []string
+		for _, col := range columns {
+			value, ok := obj[col.key]
+			cell := ""
+			switch {
+			case !ok || value == nil:
+			case col.format != nil:
+				cell = col.format(value)
+			default:
+				cell = fmt.Sprint(value)
+			}
+			cells = append(cells, strings.ReplaceAll(cell, "\n", " "))
+		}
+		fmt.Fprintln(w, strings.Join(cells, "\t"))
+	}
+	return w.Flush()
+}
+
+func status(v interface{}) string {
+	id, _ := v.(float64)
+	if name, ok := statusNames[id]; ok {
+		return name
+	}
+	return fmt.Sprint(v)
+}
+
+// duration formats nanoseconds
+func duration(v interface{}) string {
+	ns, _ := v.(float64)
+	return time.Duration(ns).Round(time.Millisecond).String()
+}
+
+// seconds formats the raw seconds of intervals and timeouts
+func seconds(v interface{}) string {
+	s, _ := v.(float64)
+	return (time.Duration(s) * time.Second).String()
+}
+
+func timestamp(v interface{}) string {
+	t, err := time.Parse(time.RFC3339Nano, fmt.Sprint(v))
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+func list(v interface{}) string {
+	items, _ := v.([]interface{})
+	var s []string
+	for _, item := range items {
+		s = append(s, fmt.Sprint(item))
+	}
+	return strings.Join(s, ",")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 	log "github.com/sirupsen/logrus"
 	"os"
@@ -9,6 +10,8 @@ import (
 	"pingr/internal/bus"
 	"pingr/internal/config"
 	"pingr/internal/dao"
+	"pingr/internal/gitops"
+	"pingr/internal/ingest"
 	"pingr/internal/logging"
 	"pingr/internal/resources"
 	"pingr/internal/scheduler"
@@ -24,7 +27,8 @@ func main() {
 	closing := ctx.Done()
 	defer cancel()
 
-	go signaling(cancel)
+	reloads := make(chan struct{}, 1)
+	go signaling(cancel, reloads)
 	logging.SetDefault()
 
 	log.WithField("pid", os.Getpid()).Info("Starting pingr")
@@ -40,15 +44,23 @@ func main() {
 
 	log.WithField("pid", os.Getpid()).Info("Starting scheduler")
 
-	_ = scheduler.New(db, buz)
+	sched := scheduler.New(closing, db, buz)
+
+	ingest.Start(closing, db, buz)
+
+	gitops.Apply(db, buz)
+	go reloading(closing, reloads, db, buz)
 
 	resources.Init(closing, db, buz)
 
+	log.Info("Waiting for running tests")
+	sched.Wait()
+
 	log.Info("Terminating service")
 }
 
 
-func signaling(cancel context.CancelFunc) {
+func signaling(cancel context.CancelFunc, reloads chan<- struct{}) {
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 
@@ -67,14 +79,31 @@ func signaling(cancel context.CancelFunc) {
 				time.AfterFunc(config.Get().TermDuration, cancel)
 
 			case syscall.SIGHUP:
-				log.Info("Got SIGHUP, reloading.")
-				err := config.Reload()
-				if err != nil {
-					log.WithError(err).Warn("could not reload config")
+				select {
+				case reloads <- struct{}{}:
+				default: // Already reloading
 				}
 			}
 		}
 	}
 }
 
+// reloading reloads the config on SIGHUP and then reconciles the configuration directory, one after the other so
+// that the directory is applied with the reloaded config
+func reloading(closing <-chan struct{}, reloads <-chan struct{}, db *sqlx.DB, buz *bus.Bus) {
+	for {
+		select {
+		case <-reloads:
+			log.Info("Got SIGHUP, reloading.")
+			err := config.Reload()
+			if err != nil {
+				log.WithError(err).Warn("could not reload config")
+			}
+			gitops.Apply(db, buz)
+		case <-closing:
+			return
+		}
+	}
+}
+
 
@@ -0,0 +1,325 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"net/url"
+	"pingr"
+	"pingr/internal/config"
+	"pingr/internal/dao"
+	"pingr/internal/sec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionCookie holds the token of the session of a user signed in through OpenID Connect
+const SessionCookie = "pingr_session"
+
+// Principal is who a request is made by, a user signed in with basic auth, one of its API tokens or a session
+type Principal struct {
+	UserId   string `json:"user_id"` // Empty for the BASIC_AUTH_USER admin of the config and sessions
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Scope    string `json:"scope"`
+	TokenId  string `json:"token_id,omitempty"` // Set if authenticated by an API token
+	Session  bool   `json:"session,omitempty"`  // Set if authenticated by a session
+}
+
+func (p Principal) String() string {
+	switch {
+	case p.TokenId != "":
+		return p.Username + " (token " + p.TokenId + ")"
+	case p.Session:
+		return p.Username + " (session)"
+	}
+	return p.Username
+}
+
+// HasRole is whether the principal has at least the permissions of the role
+func (p Principal) HasRole(role string) bool {
+	return pingr.ValidRole(p.Role) && pingr.RoleRank(p.Role) >= pingr.RoleRank(role)
+}
+
+// Get returns the principal of an authenticated request
+func Get(c echo.Context) Principal {
+	p, _ := c.Get("Principal").(Principal)
+	return p
+}
+
+// Authenticate requires basic auth of a user, an API token as "Authorization: Bearer <token>" or a session cookie.
+// Without any, and with OpenID Connect enabled, the UI is redirected to sign in
+func Authenticate(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+
+		var p Principal
+		var err error
+		authorization := c.Request().Header.Get(echo.HeaderAuthorization)
+		if token := strings.TrimPrefix(authorization, "Bearer "); token != authorization {
+			var ok bool
+			p, ok, err = tokenPrincipal(token, db)
+			if err != nil {
+				return c.String(500, "could not get token: "+err.Error())
+			}
+			if !ok {
+				return c.String(401, "invalid or expired token")
+			}
+		} else if username, password, ok := c.Request().BasicAuth(); ok {
+			p, ok, err = userPrincipal(username, password, db)
+			if err != nil {
+				return c.String(500, "could not get user: "+err.Error())
+			}
+			if !ok {
+				c.Response().Header().Set(echo.HeaderWWWAuthenticate, "basic realm=Restricted")
+				return c.String(401, "invalid username or password")
+			}
+		} else if cookie, err := c.Cookie(SessionCookie); err == nil && cookie.Value != "" {
+			p, ok, err = sessionPrincipal(cookie.Value, db)
+			if err != nil {
+				return c.String(500, "could not get session: "+err.Error())
+			}
+			if !ok {
+				ClearSession(c)
+				return unauthenticated(c, "session has expired")
+			}
+			if !SameOrigin(c.Request()) {
+				return c.String(403, "forbidden: cross-origin request")
+			}
+		} else {
+			return unauthenticated(c, "missing credentials")
+		}
+
+		c.Set("Principal", p)
+		c.Set("User", p.String()) // Logged with the request
+		return next(c)
+	}
+}
+
+// Allow lets principals with at least the read role make GET and HEAD requests, and the write role all others.
+// Read-only tokens are limited to reads, and push-only tokens are not allowed at all
+func Allow(read string, write string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			p := Get(c)
+			method := c.Request().Method
+			if msg := forbidden(p, method == "GET" || method == "HEAD", read, write); msg != "" {
+				return c.String(403, "forbidden: "+msg)
+			}
+			return next(c)
+		}
+	}
+}
+
+// AllowWrite treats all requests as writes, requiring the write role and a token that is not read-only, e.g. for
+// reads exposing credentials
+func AllowWrite(write string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if msg := forbidden(Get(c), false, write, write); msg != "" {
+				return c.String(403, "forbidden: "+msg)
+			}
+			return next(c)
+		}
+	}
+}
+
+// forbidden returns why the principal may not make the request, or an empty string if it may
+func forbidden(p Principal, reading bool, read string, write string) string {
+	switch {
+	case p.Scope == pingr.ScopePush:
+		return "the token can only push"
+	case reading && !p.HasRole(read):
+		return "requires the role " + read
+	case !reading && p.Scope == pingr.ScopeRead:
+		return "the token is read-only"
+	case !reading && !p.HasRole(write):
+		return "requires the role " + write
+	}
+	return ""
+}
+
+// Pusher returns the principal of the API token of a push, if it is one allowed to push, i.e. of an editor and
+// with the push scope or all scopes
+func Pusher(c echo.Context) (Principal, bool, error) {
+	db := c.Get("DB").(*sqlx.DB)
+	authorization := c.Request().Header.Get(echo.HeaderAuthorization)
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	if token == authorization || token == "" {
+		return Principal{}, false, nil
+	}
+	p, ok, err := tokenPrincipal(token, db)
+	if err != nil || !ok {
+		return p, false, err
+	}
+	if p.Scope == pingr.ScopeRead || !p.HasRole(pingr.RoleEditor) {
+		return p, false, nil
+	}
+	return p, true, nil
+}
+
+func tokenPrincipal(token string, db *sqlx.DB) (Principal, bool, error) {
+	t, err := dao.GetAPITokenByHash(sec.HashToken(token), db)
+	if err == sql.ErrNoRows {
+		return Principal{}, false, nil
+	}
+	if err != nil {
+		return Principal{}, false, err
+	}
+	now := time.Now()
+	if t.Expired(now) {
+		return Principal{}, false, nil
+	}
+	user, err := dao.GetUser(t.UserId, db)
+	if err == sql.ErrNoRows {
+		return Principal{}, false, nil
+	}
+	if err != nil {
+		return Principal{}, false, err
+	}
+
+	err = dao.SetAPITokenUsed(t.TokenId, now, db)
+	if err != nil {
+		return Principal{}, false, err
+	}
+	return Principal{
+		UserId:   user.UserId,
+		Username: user.Username,
+		Role:     user.Role,
+		Scope:    t.Scope,
+		TokenId:  t.TokenId,
+	}, true, nil
+}
+
+func sessionPrincipal(token string, db *sqlx.DB) (Principal, bool, error) {
+	session, err := dao.GetSessionByHash(sec.HashToken(token), db)
+	if err == sql.ErrNoRows {
+		return Principal{}, false, nil
+	}
+	if err != nil {
+		return Principal{}, false, err
+	}
+	if !time.Now().Before(session.ExpiresAt) {
+		return Principal{}, false, nil
+	}
+	return Principal{
+		Username: session.Username,
+		Role:     session.Role,
+		Scope:    pingr.ScopeAll,
+		Session:  true,
+	}, true, nil
+}
+
+// unauthenticated redirects page loads of the UI to sign in with OpenID Connect, if enabled, and otherwise asks for
+// basic auth
+func unauthenticated(c echo.Context, msg string) error {
+	req := c.Request()
+	if config.Get().OIDCIssuer != "" && req.Method == "GET" && !strings.HasPrefix(req.URL.Path, "/api/") {
+		return c.Redirect(302, "/api/oidc/login?"+url.Values{"redirect": {req.URL.RequestURI()}}.Encode())
+	}
+	c.Response().Header().Set(echo.HeaderWWWAuthenticate, "basic realm=Restricted")
+	return c.String(401, msg)
+}
+
+// SameOrigin checks that requests authenticated by cookie, other than reads, come from the UI, as browsers send the
+// cookie with requests from other sites too. Requests without Origin and Referer are refused, the origin unknown
+func SameOrigin(req *http.Request) bool {
+	if req.Method == "GET" || req.Method == "HEAD" {
+		return true
+	}
+	origin := req.Header.Get("Origin")
+	if origin == "" {
+		origin = req.Header.Get("Referer")
+	}
+	if origin == "" {
+		return false
+	}
+	base, err := url.Parse(config.Get().BaseUrl)
+	if err != nil {
+		return false
+	}
+	o, err := url.Parse(origin)
+	return err == nil && o.Scheme == base.Scheme && o.Host == base.Host
+}
+
+// ClearSession removes the session cookie
+func ClearSession(c echo.Context) {
+	c.SetCookie(&http.Cookie{
+		Name:     SessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
+
+func userPrincipal(username string, password string, db *sqlx.DB) (Principal, bool, error) {
+	cfg := config.Get()
+	if cfg.BasicAuthUser != "" && cfg.BasicAuthPass != "" &&
+		subtle.ConstantTimeCompare([]byte(username), []byte(cfg.BasicAuthUser)) == 1 &&
+		subtle.ConstantTimeCompare([]byte(password), []byte(cfg.BasicAuthPass)) == 1 {
+		return Principal{Username: username, Role: pingr.RoleAdmin, Scope: pingr.ScopeAll}, true, nil
+	}
+
+	user, err := dao.GetUserByUsername(username, db)
+	if err == sql.ErrNoRows {
+		return Principal{}, false, nil
+	}
+	if err != nil {
+		return Principal{}, false, err
+	}
+	if !verified(username, password, user.PasswordHash) {
+		return Principal{}, false, nil
+	}
+	return Principal{
+		UserId:   user.UserId,
+		Username: user.Username,
+		Role:     user.Role,
+		Scope:    pingr.ScopeAll,
+	}, true, nil
+}
+
+// Passwords are checked against their hashes once every verifiedFor, rather than on each request of the UI
+const verifiedFor = 5 * time.Minute
+
+type verification struct {
+	passwordHash string
+	at           time.Time
+}
+
+var (
+	muVerifications sync.Mutex
+	verifications   = map[string]verification{}
+)
+
+// verified compares the password with the hash, or looks up a recent comparison that succeeded. Changing the
+// password of the user changes the hash and so invalidates earlier comparisons
+func verified(username string, password string, passwordHash string) bool {
+	sum := sha256.Sum256([]byte(username + "\x00" + password))
+	key := hex.EncodeToString(sum[:])
+
+	muVerifications.Lock()
+	now := time.Now()
+	for k, v := range verifications {
+		if now.Sub(v.at) > verifiedFor {
+			delete(verifications, k)
+		}
+	}
+	v, ok := verifications[key]
+	muVerifications.Unlock()
+	if ok && subtle.ConstantTimeCompare([]byte(v.passwordHash), []byte(passwordHash)) == 1 {
+		return true
+	}
+
+	if !sec.ComparePassword(password, passwordHash) {
+		return false
+	}
+	muVerifications.Lock()
+	verifications[key] = verification{passwordHash: passwordHash, at: now}
+	muVerifications.Unlock()
+	return true
+}
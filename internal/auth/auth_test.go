@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"os"
+	"pingr"
+	"testing"
+)
+
+func TestForbidden(t *testing.T) {
+	cases := []struct {
+		p       Principal
+		reading bool
+		allowed bool
+	}{
+		{Principal{Role: pingr.RoleViewer, Scope: pingr.ScopeAll}, true, true},
+		{Principal{Role: pingr.RoleViewer, Scope: pingr.ScopeAll}, false, false},
+		{Principal{Role: pingr.RoleEditor, Scope: pingr.ScopeAll}, false, true},
+		{Principal{Role: pingr.RoleAdmin, Scope: pingr.ScopeAll}, false, true},
+		{Principal{Role: pingr.RoleAdmin, Scope: pingr.ScopeRead}, true, true},
+		{Principal{Role: pingr.RoleAdmin, Scope: pingr.ScopeRead}, false, false},
+		{Principal{Role: pingr.RoleAdmin, Scope: pingr.ScopePush}, true, false},
+		{Principal{Role: "", Scope: pingr.ScopeAll}, true, false},
+	}
+	for _, c := range cases {
+		msg := forbidden(c.p, c.reading, pingr.RoleViewer, pingr.RoleEditor)
+		if (msg == "") != c.allowed {
+			t.Logf("expected %+v reading %v to be allowed %v, got %q", c.p, c.reading, c.allowed, msg)
+			t.Fail()
+		}
+	}
+}
+
+func TestSameOrigin(t *testing.T) {
+	os.Setenv("BASE_URL", "https://pingr.domain.com")
+	cases := []struct {
+		method  string
+		headers map[string]string
+		allowed bool
+	}{
+		{"GET", nil, true},
+		{"POST", nil, false},
+		{"POST", map[string]string{"Origin": "https://pingr.domain.com"}, true},
+		{"POST", map[string]string{"Referer": "https://pingr.domain.com/tests"}, true},
+		{"POST", map[string]string{"Origin": "https://evil.com"}, false},
+		{"DELETE", map[string]string{"Referer": "http://pingr.domain.com/tests"}, false},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, "/api/tests", nil)
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+		if SameOrigin(req) != c.allowed {
+			t.Logf("expected %s with %v to be allowed %v", c.method, c.headers, c.allowed)
+			t.Fail()
+		}
+	}
+}
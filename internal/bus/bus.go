@@ -1,6 +1,7 @@
 package bus
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sync"
@@ -86,6 +87,14 @@ func (b *Bus) Close(topic string) error {
 }
 
 func (b *Bus) Next(topic string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return b.NextContext(ctx, topic)
+}
+
+// NextContext waits for the next message on the topic until the context is done. TimeoutErr is returned
+// if the deadline of the context is exceeded
+func (b *Bus) NextContext(ctx context.Context, topic string) ([]byte, error) {
 	b.mu.RLock()
 	c, ok := b.topics[topic]
 	b.mu.RUnlock()
@@ -99,7 +108,10 @@ func (b *Bus) Next(topic string, timeout time.Duration) ([]byte, error) {
 			return nil, ClosedErr
 		}
 		return data, nil
-	case <-time.After(timeout):
-		return nil, TimeoutErr
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, TimeoutErr
+		}
+		return nil, ctx.Err()
 	}
 }
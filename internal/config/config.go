@@ -21,8 +21,53 @@ type Config struct {
 	SQLitePath    string `env:"SQLITE_PATH" envDefault:"pingr.sqlite"`
 	SQLiteMigrate bool   `env:"SQLITE_MIGRATE" envDefault:"false"`
 
-	BasicAuthUser string `env:"BASIC_AUTH_USER,required"`
-	BasicAuthPass string `env:"BASIC_AUTH_PASS,required"`
+	// Admin signing in with basic auth, to bootstrap users and API tokens. Can be unset once there are admin users
+	BasicAuthUser string `env:"BASIC_AUTH_USER"`
+	BasicAuthPass string `env:"BASIC_AUTH_PASS"`
+
+	// OpenID Connect sign in, enabled by setting the issuer. Users are given the highest role of their groups,
+	// mapped by OIDC_GROUP_ROLES, e.g. "pingr-admins=admin,sre=editor", or OIDC_DEFAULT_ROLE without a match.
+	// Roles are mapped when signing in, so sessions last at most 12h
+	OIDCIssuer       string        `env:"OIDC_ISSUER"` // e.g. https://idp.domain.com/realms/main
+	OIDCClientId     string        `env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret string        `env:"OIDC_CLIENT_SECRET"` // Empty for public clients
+	OIDCScopes       []string      `env:"OIDC_SCOPES" envSeparator:" " envDefault:"openid profile email groups"`
+	OIDCGroupsClaim  string        `env:"OIDC_GROUPS_CLAIM" envDefault:"groups"`
+	OIDCGroupRoles   []string      `env:"OIDC_GROUP_ROLES" envSeparator:","`
+	OIDCDefaultRole  string        `env:"OIDC_DEFAULT_ROLE"` // Empty rejects users without a mapped group
+	SessionLength    time.Duration `env:"SESSION_LENGTH" envDefault:"1h"`
+
+	PushAuthRequired bool `env:"PUSH_AUTH_REQUIRED" envDefault:"false"` // Reject pushes to tests without a push token
+
+	// Reverse proxies, as ips or CIDRs, whose X-Forwarded-For is trusted for the ip of the client, e.g. for the ip
+	// allowlists of pushes. Without any the ip of the connection is used, as the header can be set by anyone
+	TrustedProxies []string `env:"TRUSTED_PROXIES" envSeparator:","`
+
+	StatsDAddr   string `env:"STATSD_ADDR"`   // e.g. ":8125", listens on both UDP and TCP
+	GraphiteAddr string `env:"GRAPHITE_ADDR"` // e.g. ":2003", listens on both UDP and TCP
+
+	// Nagios style flap detection over the last FLAP_WINDOW results, e.g. 21, disabled by default
+	FlapWindow        int     `env:"FLAP_WINDOW" envDefault:"0"`
+	FlapHighThreshold float64 `env:"FLAP_HIGH_THRESHOLD" envDefault:"50"` // % state change to start flapping
+	FlapLowThreshold  float64 `env:"FLAP_LOW_THRESHOLD" envDefault:"25"`  // % state change to stop flapping
+
+	// Resolvers that tests with retry alternate set are retried through, each retry using the next
+	AlternateResolvers []string `env:"ALTERNATE_RESOLVERS" envSeparator:"," envDefault:"1.1.1.1,8.8.8.8"`
+
+	// Limits on the number of tests running at once, in total and against a single host, 0 means unlimited
+	MaxConcurrentTests   int `env:"MAX_CONCURRENT_TESTS" envDefault:"100"`
+	MaxConcurrentPerHost int `env:"MAX_CONCURRENT_PER_HOST" envDefault:"4"`
+
+	// With HA enabled, pingrd instances sharing the database elect a leader through a lease in the database.
+	// Only the leader runs tests, the others take over once its lease has expired
+	HA            bool          `env:"HA" envDefault:"false"`
+	HANodeId      string        `env:"HA_NODE_ID"` // Defaults to the hostname and a random suffix
+	HALeaseLength time.Duration `env:"HA_LEASE_LENGTH" envDefault:"15s"`
+
+	// Tests, contacts and test contacts declared in YAML/JSON files in the directory are loaded at startup and
+	// on SIGHUP. Objects created through the API are left alone, unless in strict mode
+	ConfigDir    string `env:"CONFIG_DIR"`
+	ConfigStrict bool   `env:"CONFIG_STRICT" envDefault:"false"`
 
 	TermDuration time.Duration `env:"TERM_DURATION" envDefault:"20s"` // time allowed for graceful shutdown
 
@@ -38,24 +83,32 @@ type Config struct {
 
 var (
 	once sync.Once
+	mu   sync.RWMutex // Guards cfg, as it is replaced on reload
 	cfg  Config
 )
 
 func Get() Config {
 	once.Do(func() {
+		mu.Lock()
+		defer mu.Unlock()
 		if err := env.Parse(&cfg); err != nil {
 			log.Panic("Couldn't parse AppConfig from env: ", err)
 		}
 	})
+	mu.RLock()
+	defer mu.RUnlock()
 	return cfg
 }
 
 func Reload() error {
+	Get() // Not to be overwritten by the first Get
 	c := Config{}
-	err := env.Parse(&cfg)
+	err := env.Parse(&c)
 	if err != nil {
 		return err
 	}
+	mu.Lock()
 	cfg = c
+	mu.Unlock()
 	return nil
 }
@@ -0,0 +1,73 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"pingr"
+	"time"
+)
+
+func GetAgents(db *sqlx.DB) ([]pingr.Agent, error) {
+	q := `
+		SELECT * FROM agents
+		ORDER BY agent_name
+	`
+	agents := []pingr.Agent{}
+	err := db.Select(&agents, q)
+	return agents, err
+}
+
+func GetAgent(id string, db *sqlx.DB) (agent pingr.Agent, err error) {
+	q := `
+		SELECT * FROM agents
+		WHERE agent_id = $1
+	`
+	err = db.Get(&agent, q, id)
+	return
+}
+
+func GetAgentByTokenHash(hash string, db *sqlx.DB) (agent pingr.Agent, err error) {
+	q := `
+		SELECT * FROM agents
+		WHERE token_hash = $1
+	`
+	err = db.Get(&agent, q, hash)
+	return
+}
+
+func PostAgent(agent pingr.Agent, db *sqlx.DB) error {
+	q := `
+		INSERT INTO agents(agent_id, agent_name, location, token_hash, created_at)
+		VALUES (:agent_id,:agent_name,:location,:token_hash,:created_at)
+	`
+	_, err := db.NamedExec(q, agent)
+	return err
+}
+
+func PutAgentToken(id string, hash string, db *sqlx.DB) error {
+	q := `
+		UPDATE agents
+		SET token_hash = $1
+		WHERE agent_id = $2
+	`
+	_, err := db.Exec(q, hash, id)
+	return err
+}
+
+func SetAgentSeen(id string, seen time.Time, db *sqlx.DB) error {
+	q := `
+		UPDATE agents
+		SET last_seen = $1
+		WHERE agent_id = $2
+	`
+	_, err := db.Exec(q, seen, id)
+	return err
+}
+
+func DeleteAgent(id string, db *sqlx.DB) error {
+	q := `
+		DELETE FROM agents
+		WHERE agent_id = $1
+	`
+	_, err := db.Exec(q, id)
+	return err
+}
@@ -0,0 +1,59 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// TestChange records that a test was added, updated, paused/activated, deleted or given new locations.
+// The changes make up a feed the scheduler follows to pick up edits, made through any instance, right away
+type TestChange struct {
+	ChangeId  uint64 `db:"change_id"`
+	TestId    string `db:"test_id"`
+	CreatedAt int64  `db:"created_at"` // unix ms
+}
+
+// GetTestChanges returns the changes after the given change, oldest first
+func GetTestChanges(after uint64, db *sqlx.DB) ([]TestChange, error) {
+	q := `
+		SELECT * FROM test_changes
+		WHERE change_id > $1
+		ORDER BY change_id
+	`
+	var changes []TestChange
+	err := db.Select(&changes, q, after)
+	return changes, err
+}
+
+// GetLastTestChange returns the id of the latest change, 0 if there are none
+func GetLastTestChange(db *sqlx.DB) (uint64, error) {
+	var changeId uint64
+	err := db.Get(&changeId, "SELECT coalesce(max(change_id), 0) FROM test_changes")
+	return changeId, err
+}
+
+// DeleteTestChangesBefore removes changes older than t, they have long since been picked up
+func DeleteTestChangesBefore(t time.Time, db *sqlx.DB) error {
+	q := `
+		DELETE FROM test_changes
+		WHERE created_at < $1
+	`
+	_, err := db.Exec(q, toMillis(t))
+	return err
+}
+
+// withTestChange runs f in a transaction, or the transaction db is, recording a change of the test along with it
+func withTestChange(testId string, db Ext, f func(tx *sqlx.Tx) error) error {
+	tx, ok := db.(*sqlx.Tx)
+	if !ok {
+		return InTx(db.(*sqlx.DB), func(tx *sqlx.Tx) error {
+			return withTestChange(testId, tx, f)
+		})
+	}
+	err := f(tx)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO test_changes(test_id, created_at) VALUES ($1, $2)", testId, toMillis(time.Now()))
+	return err
+}
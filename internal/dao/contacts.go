@@ -1,11 +1,10 @@
 package dao
 
 import (
-	"github.com/jmoiron/sqlx"
 	"pingr"
 )
 
-func GetContacts(db *sqlx.DB) ([]pingr.Contact, error) {
+func GetContacts(db Ext) ([]pingr.Contact, error) {
 	q := `
 		SELECT * FROM contacts
 	`
@@ -18,7 +17,7 @@ func GetContacts(db *sqlx.DB) ([]pingr.Contact, error) {
 	return contacts, nil
 }
 
-func GetContact(id string, db *sqlx.DB) (pingr.Contact, error) {
+func GetContact(id string, db Ext) (pingr.Contact, error) {
 	q := `
 		SELECT * FROM contacts 
 		WHERE contact_id = $1
@@ -32,7 +31,7 @@ func GetContact(id string, db *sqlx.DB) (pingr.Contact, error) {
 	return c, nil
 }
 
-func PostContact(contact pingr.Contact, db *sqlx.DB) error {
+func PostContact(contact pingr.Contact, db Ext) error {
 	q := `
 		INSERT INTO contacts(contact_id, contact_name, contact_type, contact_url) 
 		VALUES (:contact_id,:contact_name,:contact_type,:contact_url);
@@ -45,7 +44,7 @@ func PostContact(contact pingr.Contact, db *sqlx.DB) error {
 	return nil
 }
 
-func PutContact(contact pingr.Contact, db *sqlx.DB) error {
+func PutContact(contact pingr.Contact, db Ext) error {
 	q := `
 		UPDATE contacts 
 		SET contact_name=:contact_name,
@@ -61,7 +60,7 @@ func PutContact(contact pingr.Contact, db *sqlx.DB) error {
 	return nil
 }
 
-func DeleteContact(id string, db *sqlx.DB) error {
+func DeleteContact(id string, db Ext) error {
 	q := `
 		DELETE FROM contacts 
 		WHERE contact_id = $1
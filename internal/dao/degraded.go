@@ -0,0 +1,34 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"pingr"
+)
+
+func GetDegradation(testId string, db *sqlx.DB) (pingr.Degradation, error) {
+	q := `
+		SELECT * FROM degraded
+		WHERE test_id = $1
+	`
+	var d pingr.Degradation
+	err := db.Get(&d, q, testId)
+	return d, err
+}
+
+func PostDegradation(d pingr.Degradation, db *sqlx.DB) error {
+	q := `
+		INSERT INTO degraded(test_id, message, started_at)
+		VALUES (:test_id,:message,:started_at)
+	`
+	_, err := db.NamedExec(q, d)
+	return err
+}
+
+func DeleteDegradation(testId string, db Ext) error {
+	q := `
+		DELETE FROM degraded
+		WHERE test_id = $1
+	`
+	_, err := db.Exec(q, testId)
+	return err
+}
@@ -0,0 +1,64 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+type testDependency struct {
+	TestId   string `db:"test_id"`
+	ParentId string `db:"parent_id"`
+}
+
+// GetTestDependencies returns the parents of every test with dependencies, by test id
+func GetTestDependencies(db *sqlx.DB) (map[string][]string, error) {
+	var rows []testDependency
+	err := db.Select(&rows, "SELECT * FROM test_dependencies")
+	if err != nil {
+		return nil, err
+	}
+	deps := map[string][]string{}
+	for _, row := range rows {
+		deps[row.TestId] = append(deps[row.TestId], row.ParentId)
+	}
+	return deps, nil
+}
+
+func GetTestParents(testId string, db *sqlx.DB) ([]string, error) {
+	q := `
+		SELECT parent_id FROM test_dependencies
+		WHERE test_id = $1
+	`
+	parents := []string{}
+	err := db.Select(&parents, q, testId)
+	return parents, err
+}
+
+func PutTestParents(testId string, parentIds []string, db *sqlx.DB) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM test_dependencies WHERE test_id = $1", testId)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	for _, parentId := range parentIds {
+		_, err = tx.Exec("INSERT INTO test_dependencies(test_id, parent_id) VALUES ($1, $2)", testId, parentId)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteTestDependencies removes the test both as a child and as a parent
+func DeleteTestDependencies(testId string, db Ext) error {
+	q := `
+		DELETE FROM test_dependencies
+		WHERE test_id = $1 OR parent_id = $1
+	`
+	_, err := db.Exec(q, testId)
+	return err
+}
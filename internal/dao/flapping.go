@@ -0,0 +1,44 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"pingr"
+)
+
+func GetAllFlapping(db *sqlx.DB) ([]pingr.Flapping, error) {
+	q := `
+		SELECT * FROM flapping
+		ORDER BY started_at DESC
+	`
+	flapping := []pingr.Flapping{}
+	err := db.Select(&flapping, q)
+	return flapping, err
+}
+
+func GetFlapping(testId string, db *sqlx.DB) (pingr.Flapping, error) {
+	q := `
+		SELECT * FROM flapping
+		WHERE test_id = $1
+	`
+	var f pingr.Flapping
+	err := db.Get(&f, q, testId)
+	return f, err
+}
+
+func PostFlapping(f pingr.Flapping, db *sqlx.DB) error {
+	q := `
+		INSERT INTO flapping(test_id, state_change, started_at)
+		VALUES (:test_id,:state_change,:started_at)
+	`
+	_, err := db.NamedExec(q, f)
+	return err
+}
+
+func DeleteFlapping(testId string, db Ext) error {
+	q := `
+		DELETE FROM flapping
+		WHERE test_id = $1
+	`
+	_, err := db.Exec(q, testId)
+	return err
+}
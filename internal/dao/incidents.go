@@ -46,7 +46,7 @@ func GetIncident(id string, db *sqlx.DB) (IncidentFull, error) {
 
 func GetIncidents(db *sqlx.DB) ([]IncidentWithTestName, error) {
 	q := `
-	SELECT incident_id,test_id, i.active, i.root_cause, i.created_at, i.closed_at, test_name, i.test_id 
+	SELECT incident_id,test_id, i.active, i.root_cause, i.created_at, i.closed_at, i.caused_by, test_name, i.test_id 
 	FROM incidents i
 	INNER JOIN tests t USING(test_id)
 	ORDER BY i.created_at DESC
@@ -59,7 +59,7 @@ func GetIncidents(db *sqlx.DB) ([]IncidentWithTestName, error) {
 
 func GetActiveIncident(testId string, db *sqlx.DB) (pingr.Incident, error) {
 	q := `
-	SELECT incident_id, test_id, active,root_cause,created_at FROM incidents 
+	SELECT incident_id, test_id, active,root_cause,created_at,caused_by FROM incidents 
 	WHERE active AND test_id = $1
 `
 	var incident pingr.Incident
@@ -73,8 +73,8 @@ func GetActiveIncident(testId string, db *sqlx.DB) (pingr.Incident, error) {
 
 func PostIncident(incident pingr.Incident, db *sqlx.DB) (uint64, error) {
 	q := `
-	INSERT INTO incidents(test_id, active, root_cause, created_at)  
-	VALUES(:test_id, :active, :root_cause, :created_at)
+	INSERT INTO incidents(test_id, active, root_cause, created_at, caused_by)  
+	VALUES(:test_id, :active, :root_cause, :created_at, :caused_by)
 `
 	rows, err := db.NamedExec(q, incident)
 	if err != nil {
@@ -88,6 +88,17 @@ func PostIncident(incident pingr.Incident, db *sqlx.DB) (uint64, error) {
 	return uint64(incidentId), nil
 }
 
+// SetIncidentCause sets the parent test causing the incident, empty if the incident is the test's own
+func SetIncidentCause(incidentId uint64, causedBy string, db *sqlx.DB) error {
+	q := `
+	UPDATE incidents
+	SET caused_by = $1
+	WHERE incident_id = $2
+`
+	_, err := db.Exec(q, causedBy, incidentId)
+	return err
+}
+
 func CloseIncident(incidentId uint64, db *sqlx.DB) error {
 	q := `
 	UPDATE incidents
@@ -103,7 +114,7 @@ func CloseIncident(incidentId uint64, db *sqlx.DB) error {
 	return nil
 }
 
-func CloseTestIncident(testId string, db *sqlx.DB) error {
+func CloseTestIncident(testId string, db Ext) error {
 	q := `
 	UPDATE incidents
 	SET active = 0,
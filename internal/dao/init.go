@@ -50,8 +50,145 @@ func migrateSchema(db *sqlx.DB) error {
 
 	switch version {
 	case 0:
-		log.Info("  - Migrating to ", 1)
-		_, err := db.Exec(_schema_v1_up)
+		err = migrateTo(1, _schema_v1_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 1:
+		err = migrateTo(2, _schema_v2_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 2:
+		err = migrateTo(3, _schema_v3_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 3:
+		err = migrateTo(4, _schema_v4_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 4:
+		err = migrateTo(5, _schema_v5_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 5:
+		err = migrateTo(6, _schema_v6_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 6:
+		err = migrateTo(7, _schema_v7_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 7:
+		err = migrateTo(8, _schema_v8_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 8:
+		err = migrateTo(9, _schema_v9_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 9:
+		err = migrateTo(10, _schema_v10_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 10:
+		err = migrateTo(11, _schema_v11_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 11:
+		err = migrateTo(12, _schema_v12_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 12:
+		err = migrateTo(13, _schema_v13_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 13:
+		err = migrateTo(14, _schema_v14_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 14:
+		err = migrateTo(15, _schema_v15_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 15:
+		err = migrateTo(16, _schema_v16_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 16:
+		err = migrateTo(17, _schema_v17_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 17:
+		err = migrateTo(18, _schema_v18_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 18:
+		err = migrateTo(19, _schema_v19_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 19:
+		err = migrateTo(20, _schema_v20_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 20:
+		err = migrateTo(21, _schema_v21_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 21:
+		err = migrateTo(22, _schema_v22_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 22:
+		err = migrateTo(23, _schema_v23_up, db)
+		if err != nil {
+			return err
+		}
+		fallthrough
+	case 23:
+		err = migrateTo(24, _schema_v24_up, db)
 		if err != nil {
 			return err
 		}
@@ -60,6 +197,20 @@ func migrateSchema(db *sqlx.DB) error {
 	return nil
 }
 
+func migrateTo(version int, schema string, db *sqlx.DB) error {
+	log.Info("  - Migrating to ", version)
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(schema)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
 func fileExists(filename string) bool {
 	if _, err := os.Stat(filename); os.IsNotExist(err) {
 		return false
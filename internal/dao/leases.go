@@ -0,0 +1,44 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"time"
+)
+
+// AcquireLease takes, or renews, the lease for the holder until the given time. It fails, returning false,
+// if the lease is held by someone else and has not yet expired
+func AcquireLease(name string, holder string, until time.Time, db *sqlx.DB) (bool, error) {
+	q := `
+		INSERT INTO leases(lease_name, holder, expires_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (lease_name) DO UPDATE
+		SET holder = excluded.holder,
+		    expires_at = excluded.expires_at
+		WHERE leases.holder = excluded.holder
+		   OR leases.expires_at < $4
+	`
+	res, err := db.Exec(q, name, holder, toMillis(until), toMillis(time.Now()))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// ReleaseLease gives up the lease, if held by the holder, so that someone else can take it right away
+func ReleaseLease(name string, holder string, db *sqlx.DB) error {
+	q := `
+		DELETE FROM leases
+		WHERE lease_name = $1
+		  AND holder = $2
+	`
+	_, err := db.Exec(q, name, holder)
+	return err
+}
+
+func toMillis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
@@ -0,0 +1,71 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"pingr"
+)
+
+// GetTestLocations returns the locations the test is assigned to, empty if it is only run locally
+func GetTestLocations(testId string, db *sqlx.DB) ([]string, error) {
+	q := `
+		SELECT location FROM test_locations
+		WHERE test_id = $1
+		ORDER BY location
+	`
+	locations := []string{}
+	err := db.Select(&locations, q, testId)
+	return locations, err
+}
+
+func PutTestLocations(testId string, locations []string, db *sqlx.DB) error {
+	return withTestChange(testId, db, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec("DELETE FROM test_locations WHERE test_id = $1", testId)
+		if err != nil {
+			return err
+		}
+		for _, location := range locations {
+			_, err = tx.Exec("INSERT INTO test_locations(test_id, location) VALUES ($1, $2)", testId, location)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func DeleteTestLocations(testId string, db Ext) error {
+	q := `
+		DELETE FROM test_locations
+		WHERE test_id = $1
+	`
+	_, err := db.Exec(q, testId)
+	return err
+}
+
+// GetLocationTests returns the active tests assigned to the location
+func GetLocationTests(location string, db *sqlx.DB) ([]pingr.GenericTest, error) {
+	q := `
+		SELECT t.* FROM tests t
+		INNER JOIN test_locations tl ON tl.test_id = t.test_id
+		WHERE tl.location = $1
+		  AND t.active
+		ORDER BY t.test_name
+	`
+	tests := []pingr.GenericTest{}
+	err := db.Select(&tests, q, location)
+	return tests, err
+}
+
+// GetLatestLocationResult returns the latest successful, degraded, failed, timed out or maintenance log of a test from the location
+func GetLatestLocationResult(testId string, location string, db *sqlx.DB) (l pingr.Log, err error) {
+	q := `
+		SELECT * FROM logs
+		WHERE test_id = $1
+		  AND location = $2
+		  AND status_id IN (1, 2, 3, 9, 11)
+		ORDER BY log_id DESC
+		LIMIT 1
+	`
+	err = db.Get(&l, q, testId, location)
+	return
+}
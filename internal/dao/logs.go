@@ -3,6 +3,7 @@ package dao
 import (
 	"github.com/jmoiron/sqlx"
 	"pingr"
+	"time"
 )
 
 type FullLog struct {
@@ -56,9 +57,23 @@ func GetTestLogs(id string, db *sqlx.DB) ([]pingr.Log, error) {
 	return logs, nil
 }
 
+// GetTestLogsAfter returns the latest logs of the test added after the given log, newest first. A negative limit means no limit
+func GetTestLogsAfter(id string, after uint64, limit int, db *sqlx.DB) ([]pingr.Log, error) {
+	q := `
+		SELECT * FROM logs
+		WHERE test_id = $1
+		  AND log_id > $2
+		ORDER BY log_id DESC
+		LIMIT $3
+	`
+	logs := []pingr.Log{}
+	err := db.Select(&logs, q, id, after, limit)
+	return logs, err
+}
+
 func GetTestLogsLimited(id string, limit int, db *sqlx.DB) ([]FullLog, error) {
 	q := `
-		SELECT sm.status_name, message, created_at, response_time FROM logs
+		SELECT sm.status_name, logs.status_id, message, created_at, response_time FROM logs
 		INNER JOIN status_map sm on logs.status_id = sm.status_id
 		WHERE test_id = $1
 		ORDER BY created_at DESC
@@ -91,17 +106,21 @@ func GetTestLogsDaysLimited(id string, days string, db *sqlx.DB) ([]pingr.Log, e
 	return logs, nil
 }
 
-func PostLog(log pingr.Log, db *sqlx.DB) error {
+func PostLog(log pingr.Log, db *sqlx.DB) (uint64, error) {
 	q := `
-		INSERT INTO logs(test_id, status_id, message, response_time, created_at) 
-		VALUES(:test_id,:status_id,:message,:response_time,:created_at);
+		INSERT INTO logs(test_id, status_id, message, response_time, manual, location, created_at) 
+		VALUES(:test_id,:status_id,:message,:response_time,:manual,:location,:created_at);
 	`
-	_, err := db.NamedExec(q, log)
+	rows, err := db.NamedExec(q, log)
 	if err != nil {
-		return err
+		return 0, err
+	}
+	logId, err := rows.LastInsertId()
+	if err != nil {
+		return 0, err
 	}
 
-	return nil
+	return uint64(logId), nil
 }
 
 func DeleteLog(logId uint64, db *sqlx.DB) error {
@@ -117,7 +136,7 @@ func DeleteLog(logId uint64, db *sqlx.DB) error {
 	return nil
 }
 
-func DeleteTestLogs(testId string, db *sqlx.DB) error {
+func DeleteTestLogs(testId string, db Ext) error {
 	q := `
 		DELETE FROM logs
 		WHERE test_id = $1
@@ -143,3 +162,31 @@ func DeleteLastNLogs(n uint, db *sqlx.DB) error {
 
 	return nil
 }
+
+// GetTestResults returns the status of the latest successful, degraded, failed or timed out runs of a test, newest first
+func GetTestResults(id string, limit int, db *sqlx.DB) ([]uint, error) {
+	q := `
+		SELECT status_id FROM logs
+		WHERE test_id = $1
+		  AND status_id IN (1, 2, 3, 11)
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	var statuses []uint
+	err := db.Select(&statuses, q, id, limit)
+	return statuses, err
+}
+
+// GetTestResponseTimes returns the response times of the latest successful or degraded runs of a test
+func GetTestResponseTimes(id string, limit int, db *sqlx.DB) ([]time.Duration, error) {
+	q := `
+		SELECT response_time FROM logs
+		WHERE test_id = $1
+		  AND status_id IN (1, 11)
+		ORDER BY created_at DESC
+		LIMIT $2
+	`
+	var rts []time.Duration
+	err := db.Select(&rts, q, id, limit)
+	return rts, err
+}
@@ -0,0 +1,205 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"pingr"
+)
+
+type maintenanceTest struct {
+	MaintenanceId string `db:"maintenance_id"`
+	TestId        string `db:"test_id"`
+}
+
+type maintenanceTag struct {
+	MaintenanceId string `db:"maintenance_id"`
+	Tag           string `db:"tag"`
+}
+
+func GetMaintenances(db *sqlx.DB) ([]pingr.Maintenance, error) {
+	q := `
+		SELECT * FROM maintenance
+		ORDER BY starts_at DESC
+	`
+	var maintenances []pingr.Maintenance
+	err := db.Select(&maintenances, q)
+	if err != nil {
+		return nil, err
+	}
+
+	return withMaintenanceSelectors(maintenances, "", db)
+}
+
+func GetMaintenance(id string, db *sqlx.DB) (pingr.Maintenance, error) {
+	q := `
+		SELECT * FROM maintenance
+		WHERE maintenance_id = $1
+	`
+	var m pingr.Maintenance
+	err := db.Get(&m, q, id)
+	if err != nil {
+		return m, err
+	}
+
+	maintenances, err := withMaintenanceSelectors([]pingr.Maintenance{m}, id, db)
+	if err != nil {
+		return m, err
+	}
+	return maintenances[0], nil
+}
+
+// GetTestMaintenances returns all maintenance covering the test, by id or by any of its tags, active or not.
+// Only the windows are returned, without the tests and tags they cover
+func GetTestMaintenances(testId string, db *sqlx.DB) ([]pingr.Maintenance, error) {
+	q := `
+		SELECT * FROM maintenance m
+		WHERE m.all_tests
+		   OR EXISTS (SELECT 1 FROM maintenance_tests mt
+		              WHERE mt.maintenance_id = m.maintenance_id
+		                AND mt.test_id = $1)
+		   OR EXISTS (SELECT 1 FROM maintenance_tags mg
+		              JOIN test_tags tt ON tt.tag = mg.tag
+		              WHERE mg.maintenance_id = m.maintenance_id
+		                AND tt.test_id = $1)
+	`
+	var maintenances []pingr.Maintenance
+	err := db.Select(&maintenances, q, testId)
+	return maintenances, err
+}
+
+func PostMaintenance(m pingr.Maintenance, db *sqlx.DB) error {
+	q := `
+		INSERT INTO maintenance(maintenance_id, maintenance_name, starts_at, ends_at, cron, duration, time_zone, all_tests, created_at)
+		VALUES (:maintenance_id,:maintenance_name,:starts_at,:ends_at,:cron,:duration,:time_zone,:all_tests,:created_at);
+	`
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	_, err = tx.NamedExec(q, m)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	err = putMaintenanceSelectors(m, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func PutMaintenance(m pingr.Maintenance, db *sqlx.DB) error {
+	q := `
+		UPDATE maintenance
+		SET maintenance_name = :maintenance_name,
+			starts_at = :starts_at,
+			ends_at = :ends_at,
+			cron = :cron,
+			duration = :duration,
+			time_zone = :time_zone,
+			all_tests = :all_tests
+		WHERE maintenance_id = :maintenance_id
+	`
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	_, err = tx.NamedExec(q, m)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	err = putMaintenanceSelectors(m, tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func DeleteMaintenance(id string, db *sqlx.DB) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM maintenance_tests WHERE maintenance_id = $1", id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM maintenance_tags WHERE maintenance_id = $1", id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM maintenance WHERE maintenance_id = $1", id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteTestMaintenance removes a test from all maintenance
+func DeleteTestMaintenance(testId string, db Ext) error {
+	q := `
+		DELETE FROM maintenance_tests
+		WHERE test_id = $1
+	`
+	_, err := db.Exec(q, testId)
+	return err
+}
+
+func putMaintenanceSelectors(m pingr.Maintenance, tx *sqlx.Tx) error {
+	_, err := tx.Exec("DELETE FROM maintenance_tests WHERE maintenance_id = $1", m.MaintenanceId)
+	if err != nil {
+		return err
+	}
+	for _, testId := range m.TestIds {
+		_, err = tx.Exec("INSERT INTO maintenance_tests(maintenance_id, test_id) VALUES ($1, $2)", m.MaintenanceId, testId)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("DELETE FROM maintenance_tags WHERE maintenance_id = $1", m.MaintenanceId)
+	if err != nil {
+		return err
+	}
+	for _, tag := range m.Tags {
+		_, err = tx.Exec("INSERT OR IGNORE INTO maintenance_tags(maintenance_id, tag) VALUES ($1, $2)", m.MaintenanceId, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withMaintenanceSelectors sets the tests and tags covered by the maintenance, of a single maintenance or of all
+// maintenance if maintenanceId is empty
+func withMaintenanceSelectors(maintenances []pingr.Maintenance, maintenanceId string, db *sqlx.DB) ([]pingr.Maintenance, error) {
+	var testRows []maintenanceTest
+	err := db.Select(&testRows, "SELECT * FROM maintenance_tests WHERE $1 = '' OR maintenance_id = $1", maintenanceId)
+	if err != nil {
+		return nil, err
+	}
+	var tagRows []maintenanceTag
+	err = db.Select(&tagRows, "SELECT * FROM maintenance_tags WHERE $1 = '' OR maintenance_id = $1 ORDER BY tag", maintenanceId)
+	if err != nil {
+		return nil, err
+	}
+
+	testIds := map[string][]string{}
+	for _, row := range testRows {
+		testIds[row.MaintenanceId] = append(testIds[row.MaintenanceId], row.TestId)
+	}
+	tags := map[string][]string{}
+	for _, row := range tagRows {
+		tags[row.MaintenanceId] = append(tags[row.MaintenanceId], row.Tag)
+	}
+	for i := range maintenances {
+		maintenances[i].TestIds = testIds[maintenances[i].MaintenanceId]
+		maintenances[i].Tags = tags[maintenances[i].MaintenanceId]
+	}
+	return maintenances, nil
+}
@@ -0,0 +1,51 @@
+package dao
+
+// Types of objects managed through the configuration directory
+const (
+	ManagedTest    = "test"
+	ManagedContact = "contact"
+)
+
+type managedObject struct {
+	ObjectType string `db:"object_type"`
+	ObjectId   string `db:"object_id"`
+	Hash       string `db:"hash"`
+}
+
+// GetManaged returns the hash of the declaration of each managed object of the type, by object id
+func GetManaged(objectType string, db Ext) (map[string]string, error) {
+	q := `
+		SELECT * FROM managed_objects
+		WHERE object_type = $1
+	`
+	var rows []managedObject
+	err := db.Select(&rows, q, objectType)
+	if err != nil {
+		return nil, err
+	}
+	managed := map[string]string{}
+	for _, row := range rows {
+		managed[row.ObjectId] = row.Hash
+	}
+	return managed, nil
+}
+
+func PutManaged(objectType string, objectId string, hash string, db Ext) error {
+	q := `
+		INSERT INTO managed_objects(object_type, object_id, hash)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (object_type, object_id) DO UPDATE SET hash = excluded.hash
+	`
+	_, err := db.Exec(q, objectType, objectId, hash)
+	return err
+}
+
+func DeleteManaged(objectType string, objectId string, db Ext) error {
+	q := `
+		DELETE FROM managed_objects
+		WHERE object_type = $1
+		  AND object_id = $2
+	`
+	_, err := db.Exec(q, objectType, objectId)
+	return err
+}
@@ -0,0 +1,58 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"pingr"
+	"time"
+)
+
+func GetPushAuth(testId string, db *sqlx.DB) (pingr.PushAuth, error) {
+	q := `
+		SELECT * FROM push_auth
+		WHERE test_id = $1
+	`
+	var auth pingr.PushAuth
+	err := db.Get(&auth, q, testId)
+	return auth, err
+}
+
+func PutPushAuth(auth pingr.PushAuth, db *sqlx.DB) error {
+	q := `
+		INSERT INTO push_auth(test_id, token_hash, hmac_secret, allowed_ips, updated_at)
+		VALUES (:test_id,:token_hash,:hmac_secret,:allowed_ips,:updated_at)
+		ON CONFLICT(test_id) DO UPDATE
+		SET token_hash = excluded.token_hash,
+		    hmac_secret = excluded.hmac_secret,
+		    allowed_ips = excluded.allowed_ips,
+		    updated_at = excluded.updated_at
+	`
+	_, err := db.NamedExec(q, auth)
+	return err
+}
+
+func DeletePushAuth(testId string, db Ext) error {
+	q := `
+		DELETE FROM push_auth
+		WHERE test_id = $1
+	`
+	_, err := db.Exec(q, testId)
+	return err
+}
+
+// SeenPushSignature records the signature of a signed push, returning true if it had already been seen. Signatures
+// seen before the cutoff are forgotten, they are outside of the window a signed push is accepted in anyway
+func SeenPushSignature(signature string, seenAt time.Time, cutoff time.Time, db *sqlx.DB) (bool, error) {
+	_, err := db.Exec("DELETE FROM push_signatures WHERE seen_at < $1", toMillis(cutoff))
+	if err != nil {
+		return false, err
+	}
+	res, err := db.Exec(`
+		INSERT INTO push_signatures(signature, seen_at) VALUES ($1, $2)
+		ON CONFLICT (signature) DO NOTHING
+	`, signature, toMillis(seenAt))
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n == 0, err
+}
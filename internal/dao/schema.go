@@ -111,6 +111,7 @@ VALUES
     (3, "TimedOut"),
     (5, "Initialized"),
     (6, "Paused")
+ON CONFLICT DO NOTHING
 ;
 
 -- name: create-incidents
@@ -137,4 +138,634 @@ CREATE TABLE IF NOT EXISTS incident_contact_log (
         REFERENCES incidents (incident_id)
 );
 
+INSERT INTO _schema(version, created_at) VALUES (1, CURRENT_TIMESTAMP) ON CONFLICT DO NOTHING;
+`
+
+const _schema_v2_down = `
+-- name: drop-json-push-test-type
+CREATE TABLE tests_v1 (
+    test_id TEXT PRIMARY KEY,
+    test_name TEXT NOT NULL,
+    test_type TEXT CHECK( test_type IN (
+                                                'HTTP',
+                                                'Prometheus',
+                                                'TLS',
+                                                'DNS',
+                                                'Ping',
+                                                'SSH',
+                                                'TCP',
+                                                'HTTPPush',
+                                                'PrometheusPush'
+                                            )
+                                ),
+    url TEXT NOT NULL,
+    interval INTEGER NOT NULL,
+    timeout  INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+	active INTEGER NOT NULL,
+    blob BLOB
+);
+INSERT INTO tests_v1 SELECT * FROM tests WHERE test_type != 'JSONPush';
+DROP TABLE tests;
+ALTER TABLE tests_v1 RENAME TO tests;
+
+DELETE FROM _schema WHERE version = 2;
+`
+
+const _schema_v2_up = `
+-- name: add-json-push-test-type
+CREATE TABLE tests_v2 (
+    test_id TEXT PRIMARY KEY,
+    test_name TEXT NOT NULL,
+    test_type TEXT CHECK( test_type IN (
+                                                'HTTP',
+                                                'Prometheus',
+                                                'TLS',
+                                                'DNS',
+                                                'Ping',
+                                                'SSH',
+                                                'TCP',
+                                                'HTTPPush',
+                                                'PrometheusPush',
+                                                'JSONPush'
+                                            )
+                                ),
+    url TEXT NOT NULL,
+    interval INTEGER NOT NULL,
+    timeout  INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+	active INTEGER NOT NULL,
+    blob BLOB
+);
+INSERT INTO tests_v2 SELECT * FROM tests;
+DROP TABLE tests;
+ALTER TABLE tests_v2 RENAME TO tests;
+
+INSERT INTO _schema(version, created_at) VALUES (2, CURRENT_TIMESTAMP);
+`
+
+const _schema_v3_down = `
+-- name: drop-test-schedule
+ALTER TABLE tests DROP COLUMN cron;
+ALTER TABLE tests DROP COLUMN time_zone;
+
+DELETE FROM _schema WHERE version = 3;
+`
+
+const _schema_v3_up = `
+-- name: add-test-schedule
+ALTER TABLE tests ADD COLUMN cron TEXT NOT NULL DEFAULT '';
+ALTER TABLE tests ADD COLUMN time_zone TEXT NOT NULL DEFAULT '';
+
+INSERT INTO _schema(version, created_at) VALUES (3, CURRENT_TIMESTAMP);
+`
+
+const _schema_v4_down = `
+-- name: drop-push-auth
+DROP TABLE IF EXISTS push_auth ;
+
+DELETE FROM _schema WHERE version = 4;
+`
+
+const _schema_v4_up = `
+-- name: create-push-auth
+CREATE TABLE IF NOT EXISTS push_auth (
+    test_id TEXT PRIMARY KEY,
+    token_hash TEXT NOT NULL,
+    hmac_secret TEXT NOT NULL,
+    allowed_ips TEXT NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (test_id)
+        REFERENCES tests (test_id)
+);
+
+INSERT INTO _schema(version, created_at) VALUES (4, CURRENT_TIMESTAMP);
+`
+
+const _schema_v5_down = `
+-- name: drop-line-push-test-type
+CREATE TABLE tests_v4 (
+    test_id TEXT PRIMARY KEY,
+    test_name TEXT NOT NULL,
+    test_type TEXT CHECK( test_type IN (
+                                                'HTTP',
+                                                'Prometheus',
+                                                'TLS',
+                                                'DNS',
+                                                'Ping',
+                                                'SSH',
+                                                'TCP',
+                                                'HTTPPush',
+                                                'PrometheusPush',
+                                                'JSONPush'
+                                            )
+                                ),
+    url TEXT NOT NULL,
+    interval INTEGER NOT NULL,
+    timeout  INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+	active INTEGER NOT NULL,
+    blob BLOB,
+    cron TEXT NOT NULL DEFAULT '',
+    time_zone TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO tests_v4 SELECT * FROM tests WHERE test_type != 'LinePush';
+DROP TABLE tests;
+ALTER TABLE tests_v4 RENAME TO tests;
+
+DELETE FROM _schema WHERE version = 5;
+`
+
+const _schema_v5_up = `
+-- name: add-line-push-test-type
+CREATE TABLE tests_v5 (
+    test_id TEXT PRIMARY KEY,
+    test_name TEXT NOT NULL,
+    test_type TEXT CHECK( test_type IN (
+                                                'HTTP',
+                                                'Prometheus',
+                                                'TLS',
+                                                'DNS',
+                                                'Ping',
+                                                'SSH',
+                                                'TCP',
+                                                'HTTPPush',
+                                                'PrometheusPush',
+                                                'JSONPush',
+                                                'LinePush'
+                                            )
+                                ),
+    url TEXT NOT NULL,
+    interval INTEGER NOT NULL,
+    timeout  INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+	active INTEGER NOT NULL,
+    blob BLOB,
+    cron TEXT NOT NULL DEFAULT '',
+    time_zone TEXT NOT NULL DEFAULT ''
+);
+INSERT INTO tests_v5 SELECT * FROM tests;
+DROP TABLE tests;
+ALTER TABLE tests_v5 RENAME TO tests;
+
+INSERT INTO _schema(version, created_at) VALUES (5, CURRENT_TIMESTAMP);
+`
+
+const _schema_v6_down = `
+-- name: drop-test-retries
+ALTER TABLE tests DROP COLUMN retries;
+ALTER TABLE tests DROP COLUMN retry_delay;
+ALTER TABLE tests DROP COLUMN retry_alternate;
+
+DELETE FROM status_map WHERE status_id = 7;
+
+DELETE FROM _schema WHERE version = 6;
+`
+
+const _schema_v6_up = `
+-- name: add-test-retries
+ALTER TABLE tests ADD COLUMN retries INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tests ADD COLUMN retry_delay INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tests ADD COLUMN retry_alternate INTEGER NOT NULL DEFAULT 0;
+
+INSERT INTO status_map(status_id, status_name)
+VALUES
+    (7, "Retried")
+ON CONFLICT DO NOTHING
+;
+
+INSERT INTO _schema(version, created_at) VALUES (6, CURRENT_TIMESTAMP);
+`
+
+const _schema_v7_down = `
+-- name: drop-test-active-window
+ALTER TABLE tests DROP COLUMN active_hours;
+ALTER TABLE tests DROP COLUMN active_days;
+
+DELETE FROM status_map WHERE status_id = 8;
+
+DELETE FROM _schema WHERE version = 7;
+`
+
+const _schema_v7_up = `
+-- name: add-test-active-window
+ALTER TABLE tests ADD COLUMN active_hours TEXT NOT NULL DEFAULT '';
+ALTER TABLE tests ADD COLUMN active_days TEXT NOT NULL DEFAULT '';
+
+INSERT INTO status_map(status_id, status_name)
+VALUES
+    (8, "Inactive")
+ON CONFLICT DO NOTHING
+;
+
+INSERT INTO _schema(version, created_at) VALUES (7, CURRENT_TIMESTAMP);
+`
+
+const _schema_v8_down = `
+-- name: drop-maintenance
+DROP TABLE IF EXISTS maintenance_tests ;
+DROP TABLE IF EXISTS maintenance ;
+
+DELETE FROM status_map WHERE status_id = 9;
+
+DELETE FROM _schema WHERE version = 8;
+`
+
+const _schema_v8_up = `
+-- name: create-maintenance
+CREATE TABLE IF NOT EXISTS maintenance (
+    maintenance_id TEXT PRIMARY KEY,
+    maintenance_name TEXT NOT NULL,
+    starts_at TIMESTAMP NOT NULL,
+    ends_at TIMESTAMP NOT NULL,
+    cron TEXT NOT NULL DEFAULT '',
+    duration INTEGER NOT NULL DEFAULT 0,
+    time_zone TEXT NOT NULL DEFAULT '',
+    all_tests INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- name: create-maintenance-tests
+CREATE TABLE IF NOT EXISTS maintenance_tests (
+    maintenance_id TEXT NOT NULL,
+    test_id TEXT NOT NULL,
+    PRIMARY KEY (maintenance_id, test_id),
+    FOREIGN KEY (maintenance_id)
+        REFERENCES maintenance (maintenance_id),
+    FOREIGN KEY (test_id)
+        REFERENCES tests (test_id)
+);
+
+INSERT INTO status_map(status_id, status_name)
+VALUES
+    (9, "Maintenance")
+ON CONFLICT DO NOTHING
+;
+
+INSERT INTO _schema(version, created_at) VALUES (8, CURRENT_TIMESTAMP);
+`
+
+const _schema_v9_down = `
+-- name: drop-test-dependencies
+DROP TABLE IF EXISTS test_dependencies ;
+ALTER TABLE incidents DROP COLUMN caused_by;
+
+DELETE FROM _schema WHERE version = 9;
+`
+
+const _schema_v9_up = `
+-- name: create-test-dependencies
+CREATE TABLE IF NOT EXISTS test_dependencies (
+    test_id TEXT NOT NULL,
+    parent_id TEXT NOT NULL,
+    PRIMARY KEY (test_id, parent_id),
+    FOREIGN KEY (test_id)
+        REFERENCES tests (test_id),
+    FOREIGN KEY (parent_id)
+        REFERENCES tests (test_id)
+);
+
+-- name: add-incident-cause
+ALTER TABLE incidents ADD COLUMN caused_by TEXT NOT NULL DEFAULT '';
+
+INSERT INTO _schema(version, created_at) VALUES (9, CURRENT_TIMESTAMP);
+`
+
+const _schema_v10_down = `
+-- name: drop-flapping
+DROP TABLE IF EXISTS flapping ;
+
+DELETE FROM status_map WHERE status_id = 10;
+
+DELETE FROM _schema WHERE version = 10;
+`
+
+const _schema_v10_up = `
+-- name: create-flapping
+CREATE TABLE IF NOT EXISTS flapping (
+    test_id TEXT PRIMARY KEY,
+    state_change REAL NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (test_id)
+        REFERENCES tests (test_id)
+);
+
+INSERT INTO status_map(status_id, status_name)
+VALUES
+    (10, "Flapping")
+ON CONFLICT DO NOTHING
+;
+
+INSERT INTO _schema(version, created_at) VALUES (10, CURRENT_TIMESTAMP);
+`
+
+const _schema_v11_down = `
+-- name: drop-test-degraded
+ALTER TABLE tests DROP COLUMN degraded_threshold;
+ALTER TABLE tests DROP COLUMN degraded_factor;
+ALTER TABLE tests DROP COLUMN degraded_notify;
+
+DELETE FROM status_map WHERE status_id = 11;
+
+DELETE FROM _schema WHERE version = 11;
+`
+
+const _schema_v11_up = `
+-- name: add-test-degraded
+ALTER TABLE tests ADD COLUMN degraded_threshold INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE tests ADD COLUMN degraded_factor REAL NOT NULL DEFAULT 0;
+ALTER TABLE tests ADD COLUMN degraded_notify INTEGER NOT NULL DEFAULT 0;
+
+INSERT INTO status_map(status_id, status_name)
+VALUES
+    (11, "Degraded")
+ON CONFLICT DO NOTHING
+;
+
+INSERT INTO _schema(version, created_at) VALUES (11, CURRENT_TIMESTAMP);
+`
+
+const _schema_v12_down = `
+-- name: drop-logs-manual
+ALTER TABLE logs DROP COLUMN manual;
+
+DELETE FROM _schema WHERE version = 12;
+`
+
+const _schema_v12_up = `
+-- name: add-logs-manual
+ALTER TABLE logs ADD COLUMN manual INTEGER NOT NULL DEFAULT 0;
+
+INSERT INTO _schema(version, created_at) VALUES (12, CURRENT_TIMESTAMP);
+`
+
+const _schema_v13_down = `
+-- name: drop-test-backoff
+ALTER TABLE tests DROP COLUMN backoff_factor;
+ALTER TABLE tests DROP COLUMN backoff_limit;
+
+DELETE FROM _schema WHERE version = 13;
+`
+
+const _schema_v13_up = `
+-- name: add-test-backoff
+ALTER TABLE tests ADD COLUMN backoff_factor REAL NOT NULL DEFAULT 0;
+ALTER TABLE tests ADD COLUMN backoff_limit INTEGER NOT NULL DEFAULT 0;
+
+INSERT INTO _schema(version, created_at) VALUES (13, CURRENT_TIMESTAMP);
+`
+
+const _schema_v14_down = `
+-- name: drop-agents-table
+DROP TABLE IF EXISTS agents;
+
+-- name: drop-test-locations-table
+DROP TABLE IF EXISTS test_locations;
+
+-- name: drop-locations
+ALTER TABLE logs DROP COLUMN location;
+ALTER TABLE tests DROP COLUMN location_quorum;
+
+DELETE FROM _schema WHERE version = 14;
+`
+
+const _schema_v14_up = `
+-- name: create-agents-table
+CREATE TABLE IF NOT EXISTS agents (
+    agent_id TEXT PRIMARY KEY NOT NULL,
+    agent_name TEXT NOT NULL,
+    location TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    last_seen TIMESTAMP
+);
+CREATE INDEX IF NOT EXISTS agents_token_hash ON agents(token_hash);
+
+-- name: create-test-locations-table
+CREATE TABLE IF NOT EXISTS test_locations (
+    test_id TEXT NOT NULL,
+    location TEXT NOT NULL,
+    PRIMARY KEY (test_id, location),
+    FOREIGN KEY (test_id)
+        REFERENCES tests (test_id)
+);
+
+-- name: add-locations
+ALTER TABLE logs ADD COLUMN location TEXT NOT NULL DEFAULT 'local';
+ALTER TABLE tests ADD COLUMN location_quorum INTEGER NOT NULL DEFAULT 0;
+
+INSERT INTO _schema(version, created_at) VALUES (14, CURRENT_TIMESTAMP);
+`
+
+const _schema_v15_down = `
+-- name: drop-leases-table
+DROP TABLE IF EXISTS leases;
+
+DELETE FROM _schema WHERE version = 15;
+`
+
+const _schema_v15_up = `
+-- name: create-leases-table
+CREATE TABLE IF NOT EXISTS leases (
+    lease_name TEXT PRIMARY KEY NOT NULL,
+    holder TEXT NOT NULL,
+    expires_at INTEGER NOT NULL -- unix ms
+);
+
+INSERT INTO _schema(version, created_at) VALUES (15, CURRENT_TIMESTAMP);
+`
+
+const _schema_v16_down = `
+-- name: drop-test-changes-table
+DROP TABLE IF EXISTS test_changes;
+
+DELETE FROM _schema WHERE version = 16;
+`
+
+const _schema_v16_up = `
+-- name: create-test-changes-table
+CREATE TABLE IF NOT EXISTS test_changes (
+    change_id INTEGER PRIMARY KEY AUTOINCREMENT NOT NULL,
+    test_id TEXT NOT NULL,
+    created_at INTEGER NOT NULL -- unix ms
+);
+
+INSERT INTO _schema(version, created_at) VALUES (16, CURRENT_TIMESTAMP);
+`
+
+const _schema_v17_down = `
+-- name: drop-test-tags-table
+DROP TABLE IF EXISTS test_tags;
+
+DELETE FROM _schema WHERE version = 17;
+`
+
+const _schema_v17_up = `
+-- name: create-test-tags-table
+CREATE TABLE IF NOT EXISTS test_tags (
+    test_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (test_id, tag),
+    FOREIGN KEY (test_id)
+        REFERENCES tests (test_id)
+);
+CREATE INDEX IF NOT EXISTS test_tags_tag ON test_tags(tag);
+
+INSERT INTO _schema(version, created_at) VALUES (17, CURRENT_TIMESTAMP);
+`
+
+const _schema_v18_down = `
+-- name: drop-managed-objects-table
+DROP TABLE IF EXISTS managed_objects;
+
+DELETE FROM _schema WHERE version = 18;
+`
+
+const _schema_v18_up = `
+-- name: create-managed-objects-table
+CREATE TABLE IF NOT EXISTS managed_objects (
+    object_type TEXT NOT NULL,
+    object_id TEXT NOT NULL,
+    hash TEXT NOT NULL,
+    PRIMARY KEY (object_type, object_id)
+);
+
+INSERT INTO _schema(version, created_at) VALUES (18, CURRENT_TIMESTAMP);
+`
+
+const _schema_v19_down = `
+-- name: drop-api-tokens-table
+DROP TABLE IF EXISTS api_tokens;
+
+-- name: drop-users-table
+DROP TABLE IF EXISTS users;
+
+DELETE FROM _schema WHERE version = 19;
+`
+
+const _schema_v19_up = `
+-- name: create-users-table
+CREATE TABLE IF NOT EXISTS users (
+    user_id TEXT PRIMARY KEY NOT NULL,
+    username TEXT NOT NULL UNIQUE,
+    password_hash TEXT NOT NULL,
+    role TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+-- name: create-api-tokens-table
+CREATE TABLE IF NOT EXISTS api_tokens (
+    token_id TEXT PRIMARY KEY NOT NULL,
+    token_name TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    scope TEXT NOT NULL,
+    token_hash TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP,
+    last_used TIMESTAMP,
+    FOREIGN KEY (user_id)
+        REFERENCES users (user_id)
+);
+CREATE INDEX IF NOT EXISTS api_tokens_token_hash ON api_tokens(token_hash);
+CREATE INDEX IF NOT EXISTS api_tokens_user_id ON api_tokens(user_id);
+
+INSERT INTO _schema(version, created_at) VALUES (19, CURRENT_TIMESTAMP);
+`
+
+const _schema_v20_down = `
+-- name: drop-sessions-table
+DROP TABLE IF EXISTS sessions;
+
+DELETE FROM _schema WHERE version = 20;
+`
+
+const _schema_v20_up = `
+-- name: create-sessions-table
+CREATE TABLE IF NOT EXISTS sessions (
+    session_hash TEXT PRIMARY KEY NOT NULL,
+    subject TEXT NOT NULL,
+    username TEXT NOT NULL,
+    role TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+INSERT INTO _schema(version, created_at) VALUES (20, CURRENT_TIMESTAMP);
+`
+
+const _schema_v21_down = `
+-- name: drop-test-grace
+ALTER TABLE tests DROP COLUMN grace;
+
+DELETE FROM _schema WHERE version = 21;
+`
+
+const _schema_v21_up = `
+-- name: add-test-grace
+ALTER TABLE tests ADD COLUMN grace INTEGER NOT NULL DEFAULT 0;
+UPDATE tests SET grace = timeout
+WHERE cron != '' AND test_type IN ('HTTPPush', 'PrometheusPush', 'JSONPush', 'LinePush');
+
+INSERT INTO _schema(version, created_at) VALUES (21, CURRENT_TIMESTAMP);
+`
+
+const _schema_v22_down = `
+-- name: drop-maintenance-tags-table
+DROP TABLE IF EXISTS maintenance_tags;
+DROP INDEX IF EXISTS maintenance_tests_test_id;
+
+DELETE FROM _schema WHERE version = 22;
+`
+
+const _schema_v22_up = `
+-- name: create-maintenance-tags-table
+CREATE TABLE IF NOT EXISTS maintenance_tags (
+    maintenance_id TEXT NOT NULL,
+    tag TEXT NOT NULL,
+    PRIMARY KEY (maintenance_id, tag),
+    FOREIGN KEY (maintenance_id)
+        REFERENCES maintenance (maintenance_id)
+);
+
+-- name: index-maintenance-tests
+CREATE INDEX IF NOT EXISTS maintenance_tests_test_id ON maintenance_tests(test_id);
+
+INSERT INTO _schema(version, created_at) VALUES (22, CURRENT_TIMESTAMP);
+`
+
+const _schema_v23_down = `
+-- name: drop-degraded
+DROP TABLE IF EXISTS degraded;
+
+DELETE FROM _schema WHERE version = 23;
+`
+
+const _schema_v23_up = `
+-- name: create-degraded
+CREATE TABLE IF NOT EXISTS degraded (
+    test_id TEXT PRIMARY KEY,
+    message TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    FOREIGN KEY (test_id)
+        REFERENCES tests (test_id)
+);
+
+INSERT INTO _schema(version, created_at) VALUES (23, CURRENT_TIMESTAMP);
+`
+
+const _schema_v24_down = `
+-- name: drop-push-signatures
+DROP TABLE IF EXISTS push_signatures;
+
+DELETE FROM _schema WHERE version = 24;
+`
+
+const _schema_v24_up = `
+-- name: create-push-signatures
+CREATE TABLE IF NOT EXISTS push_signatures (
+    signature TEXT PRIMARY KEY,
+    seen_at INTEGER NOT NULL -- unix ms
+);
+
+INSERT INTO _schema(version, created_at) VALUES (24, CURRENT_TIMESTAMP);
 `
@@ -0,0 +1,43 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"pingr"
+	"time"
+)
+
+func GetSessionByHash(hash string, db *sqlx.DB) (session pingr.Session, err error) {
+	q := `
+		SELECT * FROM sessions
+		WHERE session_hash = $1
+	`
+	err = db.Get(&session, q, hash)
+	return
+}
+
+func PostSession(session pingr.Session, db *sqlx.DB) error {
+	q := `
+		INSERT INTO sessions(session_hash, subject, username, role, created_at, expires_at)
+		VALUES (:session_hash,:subject,:username,:role,:created_at,:expires_at)
+	`
+	_, err := db.NamedExec(q, session)
+	return err
+}
+
+func DeleteSession(hash string, db *sqlx.DB) error {
+	q := `
+		DELETE FROM sessions
+		WHERE session_hash = $1
+	`
+	_, err := db.Exec(q, hash)
+	return err
+}
+
+func DeleteExpiredSessions(now time.Time, db *sqlx.DB) error {
+	q := `
+		DELETE FROM sessions
+		WHERE expires_at <= $1
+	`
+	_, err := db.Exec(q, now)
+	return err
+}
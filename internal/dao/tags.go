@@ -0,0 +1,114 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"pingr"
+)
+
+type testTag struct {
+	TestId string `db:"test_id"`
+	Tag    string `db:"tag"`
+}
+
+type TagCount struct {
+	Tag   string `json:"tag" db:"tag"`
+	Tests int    `json:"tests" db:"tests"`
+}
+
+// GetTags returns all tags in use, with the number of tests tagged by each
+func GetTags(db *sqlx.DB) ([]TagCount, error) {
+	q := `
+		SELECT tag, count(*) AS tests FROM test_tags
+		GROUP BY tag
+		ORDER BY tag
+	`
+	tags := []TagCount{}
+	err := db.Select(&tags, q)
+	return tags, err
+}
+
+// GetTaggedTests returns the tests tagged with all of the tags, all tests if there are no tags
+func GetTaggedTests(tags []string, db *sqlx.DB) ([]pingr.GenericTest, error) {
+	tests, err := GetRawTests(db)
+	if err != nil {
+		return nil, err
+	}
+	tagged := []pingr.GenericTest{}
+	for _, test := range tests {
+		if hasTags(test.Tags, tags) {
+			tagged = append(tagged, test)
+		}
+	}
+	return tagged, nil
+}
+
+// GetTaggedTestsStatus returns the status of the tests tagged with all of the tags, all tests if there are no tags
+func GetTaggedTestsStatus(tags []string, db *sqlx.DB) ([]TestStatus, error) {
+	statuses, err := GetTestsStatus(db)
+	if err != nil {
+		return nil, err
+	}
+	tagged := []TestStatus{}
+	for _, status := range statuses {
+		if hasTags(status.Tags, tags) {
+			tagged = append(tagged, status)
+		}
+	}
+	return tagged, nil
+}
+
+func putTestTags(testId string, tags []string, tx *sqlx.Tx) error {
+	_, err := tx.Exec("DELETE FROM test_tags WHERE test_id = $1", testId)
+	if err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		_, err = tx.Exec("INSERT OR IGNORE INTO test_tags(test_id, tag) VALUES ($1, $2)", testId, tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getTestTags returns the tags of the test, or of all tests by test id if testId is empty
+func getTestTags(testId string, db Ext) (map[string][]string, error) {
+	q := `
+		SELECT * FROM test_tags
+		WHERE $1 = '' OR test_id = $1
+		ORDER BY tag
+	`
+	var rows []testTag
+	err := db.Select(&rows, q, testId)
+	if err != nil {
+		return nil, err
+	}
+	tags := map[string][]string{}
+	for _, row := range rows {
+		tags[row.TestId] = append(tags[row.TestId], row.Tag)
+	}
+	return tags, nil
+}
+
+func hasTags(have []string, want []string) bool {
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if h == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func withEmpty(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
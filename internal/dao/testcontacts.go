@@ -13,7 +13,7 @@ type TestContactType struct {
 	Threshold   uint   `json:"threshold" db:"threshold"`
 }
 
-func GetAllTestContacts(db *sqlx.DB) ([]pingr.TestContact, error) {
+func GetAllTestContacts(db Ext) ([]pingr.TestContact, error) {
 	q := `
 		SELECT * FROM test_contacts
 	`
@@ -26,7 +26,7 @@ func GetAllTestContacts(db *sqlx.DB) ([]pingr.TestContact, error) {
 	return contacts, nil
 }
 
-func GetTestContacts(id string, db *sqlx.DB) ([]pingr.TestContact, error) {
+func GetTestContacts(id string, db Ext) ([]pingr.TestContact, error) {
 	q := `
 		SELECT * FROM test_contacts 
 		WHERE test_id = $1
@@ -65,7 +65,7 @@ func GetTestContactsToContact(id string, db *sqlx.DB) ([]pingr.Contact, error) {
          FROM logs
                   INNER JOIN _test
                              USING (test_id)
-         WHERE NOT (status_id = 2 OR status_id = 3)
+         WHERE NOT (status_id = 2 OR status_id = 3 OR status_id = 7 OR status_id = 10)
          ORDER BY created_at DESC
          LIMIT 1
      ),
@@ -105,7 +105,7 @@ WHERE f.fails >= threshold
 	return contacts, nil
 }
 
-func PostTestContact(testContact pingr.TestContact, db *sqlx.DB) error {
+func PostTestContact(testContact pingr.TestContact, db Ext) error {
 	q := `
 		INSERT INTO test_contacts(contact_id, test_id, threshold) 
 		VALUES (:contact_id,:test_id,:threshold);
@@ -118,6 +118,17 @@ func PostTestContact(testContact pingr.TestContact, db *sqlx.DB) error {
 	return nil
 }
 
+// PutTestContact adds the contact to the test, or updates its threshold if it is already added
+func PutTestContact(testContact pingr.TestContact, db Ext) error {
+	q := `
+		INSERT INTO test_contacts(contact_id, test_id, threshold)
+		VALUES (:contact_id,:test_id,:threshold)
+		ON CONFLICT (contact_id, test_id) DO UPDATE SET threshold = excluded.threshold;
+	`
+	_, err := db.NamedExec(q, testContact)
+	return err
+}
+
 func DeleteTestContact(jId, cId string, db *sqlx.DB) error {
 	q := `
 		DELETE FROM test_contacts 
@@ -131,7 +142,7 @@ func DeleteTestContact(jId, cId string, db *sqlx.DB) error {
 	return nil
 }
 
-func DeleteTestContacts(jId string, db *sqlx.DB) error {
+func DeleteTestContacts(jId string, db Ext) error {
 	q := `
 		DELETE FROM test_contacts 
 		WHERE test_id = $2
@@ -143,3 +154,13 @@ func DeleteTestContacts(jId string, db *sqlx.DB) error {
 
 	return nil
 }
+
+// DeleteContactTests removes the contact from all tests
+func DeleteContactTests(contactId string, db Ext) error {
+	q := `
+		DELETE FROM test_contacts
+		WHERE contact_id = $1
+	`
+	_, err := db.Exec(q, contactId)
+	return err
+}
@@ -1,18 +1,20 @@
 package dao
 
 import (
+	"fmt"
 	"github.com/jmoiron/sqlx"
 	"pingr"
 )
 
 type TestStatus struct {
-	TestId       string `json:"test_id" db:"test_id"`
-	TestName     string `json:"test_name" db:"test_name"`
-	TestType     string `json:"test_type" db:"test_type"`
-	Active       bool   `json:"active" db:"active"`
-	Url          string `json:"url" db:"url"`
-	StatusId     int    `json:"status_id" db:"status_id"`
-	ResponseTime int    `json:"response_time" db:"response_time"`
+	TestId       string   `json:"test_id" db:"test_id"`
+	TestName     string   `json:"test_name" db:"test_name"`
+	TestType     string   `json:"test_type" db:"test_type"`
+	Active       bool     `json:"active" db:"active"`
+	Url          string   `json:"url" db:"url"`
+	StatusId     int      `json:"status_id" db:"status_id"`
+	ResponseTime int      `json:"response_time" db:"response_time"`
+	Tags         []string `json:"tags" db:"-"`
 }
 
 type FullTestStatus struct {
@@ -20,22 +22,34 @@ type FullTestStatus struct {
 	StatusId int `json:"status_id" db:"status_id"`
 }
 
-func GetRawTests(db *sqlx.DB) ([]pingr.GenericTest, error) {
+func GetRawTests(db Ext) ([]pingr.GenericTest, error) {
 	q := `
 		SELECT * FROM tests
 		ORDER BY test_name
 	`
 	var tests []pingr.GenericTest
 	err := db.Select(&tests, q)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := getTestTags("", db)
+	for i := range tests {
+		tests[i].Tags = withEmpty(tags[tests[i].TestId])
+	}
 	return tests, err
 }
 
-func GetRawTest(id string, db *sqlx.DB) (test pingr.GenericTest, err error) {
+func GetRawTest(id string, db Ext) (test pingr.GenericTest, err error) {
 	q := `
 		SELECT * FROM tests 
 		WHERE test_id = $1
 	`
 	err = db.Get(&test, q, id)
+	if err != nil {
+		return
+	}
+	tags, err := getTestTags(id, db)
+	test.Tags = withEmpty(tags[id])
 	return
 }
 
@@ -48,16 +62,22 @@ func GetTest(id string, db *sqlx.DB) (test pingr.Test, err error) {
 	return
 }
 
-func PostTest(test pingr.GenericTest, db *sqlx.DB) error {
+func PostTest(test pingr.GenericTest, db Ext) error {
 	q := `
-		INSERT INTO tests(test_id, test_name, test_type, url, interval, timeout, created_at, active, blob) 
-		VALUES (:test_id,:test_name,:test_type,:url,:interval,:timeout,:created_at,:active,:blob);
+		INSERT INTO tests(test_id, test_name, test_type, url, interval, timeout, created_at, active, blob, cron, time_zone, retries, retry_delay, retry_alternate, active_hours, active_days, degraded_threshold, degraded_factor, degraded_notify, backoff_factor, backoff_limit, location_quorum, grace) 
+		VALUES (:test_id,:test_name,:test_type,:url,:interval,:timeout,:created_at,:active,:blob,:cron,:time_zone,:retries,:retry_delay,:retry_alternate,:active_hours,:active_days,:degraded_threshold,:degraded_factor,:degraded_notify,:backoff_factor,:backoff_limit,:location_quorum,:grace);
 	`
-	_, err := db.NamedExec(q, test)
-	return err
+	return withTestChange(test.TestId, db, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExec(q, test)
+		if err != nil {
+			return err
+		}
+		return putTestTags(test.TestId, test.Tags, tx)
+	})
 }
 
-func PutTest(test pingr.GenericTest, db *sqlx.DB) error {
+// PutTest updates the test, and its tags unless they are nil, so that clients unaware of tags leave them be
+func PutTest(test pingr.GenericTest, db Ext) error {
 	q := `
 		UPDATE tests 
 		SET test_name = :test_name,
@@ -67,20 +87,102 @@ func PutTest(test pingr.GenericTest, db *sqlx.DB) error {
 		    timeout = :timeout,
 			created_at = :created_at,
 		    active = :active,
-			blob = :blob
+			blob = :blob,
+			cron = :cron,
+			time_zone = :time_zone,
+			retries = :retries,
+			retry_delay = :retry_delay,
+			retry_alternate = :retry_alternate,
+			active_hours = :active_hours,
+			active_days = :active_days,
+			degraded_threshold = :degraded_threshold,
+			degraded_factor = :degraded_factor,
+			degraded_notify = :degraded_notify,
+			backoff_factor = :backoff_factor,
+			backoff_limit = :backoff_limit,
+			location_quorum = :location_quorum,
+			grace = :grace
 		WHERE test_id = :test_id
 	`
-	_, err := db.NamedExec(q, test)
-	return err
+	return withTestChange(test.TestId, db, func(tx *sqlx.Tx) error {
+		_, err := tx.NamedExec(q, test)
+		if err != nil {
+			return err
+		}
+		if test.Tags == nil {
+			return nil
+		}
+		return putTestTags(test.TestId, test.Tags, tx)
+	})
 }
 
-func DeleteTest(id string, db *sqlx.DB) error {
+func DeleteTest(id string, db Ext) error {
 	q := `
 		DELETE FROM tests 
 		WHERE test_id = $1
 	`
-	_, err := db.Exec(q, id)
-	return err
+	return withTestChange(id, db, func(tx *sqlx.Tx) error {
+		err := putTestTags(id, nil, tx)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(q, id)
+		return err
+	})
+}
+
+// PurgeTest deletes the test along with everything referring to it
+func PurgeTest(testId string, db Ext) error {
+	err := DeleteTest(testId, db)
+	if err != nil {
+		return fmt.Errorf("Could not delete Test, %v", err)
+	}
+
+	err = DeleteTestContacts(testId, db)
+	if err != nil {
+		return fmt.Errorf("Could not delete the test's contacts: %v", err)
+	}
+
+	err = DeleteTestLogs(testId, db)
+	if err != nil {
+		return fmt.Errorf("Could not delete the test's logs: %v", err)
+	}
+
+	err = CloseTestIncident(testId, db)
+	if err != nil {
+		return fmt.Errorf("Could not close the test's incident: %v", err)
+	}
+
+	err = DeletePushAuth(testId, db)
+	if err != nil {
+		return fmt.Errorf("Could not delete the test's push authentication: %v", err)
+	}
+
+	err = DeleteTestMaintenance(testId, db)
+	if err != nil {
+		return fmt.Errorf("Could not remove the test from maintenance: %v", err)
+	}
+
+	err = DeleteTestDependencies(testId, db)
+	if err != nil {
+		return fmt.Errorf("Could not delete the test's dependencies: %v", err)
+	}
+
+	err = DeleteTestLocations(testId, db)
+	if err != nil {
+		return fmt.Errorf("Could not delete the test's locations: %v", err)
+	}
+
+	err = DeleteFlapping(testId, db)
+	if err != nil {
+		return fmt.Errorf("Could not delete the test's flapping state: %v", err)
+	}
+
+	err = DeleteDegradation(testId, db)
+	if err != nil {
+		return fmt.Errorf("Could not delete the test's degraded state: %v", err)
+	}
+	return nil
 }
 
 func GetTestStatus(id string, db *sqlx.DB) (FullTestStatus, error) {
@@ -93,6 +195,11 @@ func GetTestStatus(id string, db *sqlx.DB) (FullTestStatus, error) {
 	`
 	var testStatus FullTestStatus
 	err := db.Get(&testStatus, q, id)
+	if err != nil {
+		return testStatus, err
+	}
+	tags, err := getTestTags(id, db)
+	testStatus.Tags = withEmpty(tags[id])
 	return testStatus, err
 }
 
@@ -109,6 +216,13 @@ func GetTestsStatus(db *sqlx.DB) ([]TestStatus, error) {
 	if err != nil {
 		return nil, err
 	}
+	tags, err := getTestTags("", db)
+	if err != nil {
+		return nil, err
+	}
+	for i := range testStatus {
+		testStatus[i].Tags = withEmpty(tags[testStatus[i].TestId])
+	}
 	return testStatus, nil
 
 }
@@ -119,9 +233,10 @@ func DeactivateTest(testId string, db *sqlx.DB) error {
 		SET active = 0
 		WHERE test_id = $1
 	`
-	_, err := db.Exec(q, testId)
-
-	return err
+	return withTestChange(testId, db, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(q, testId)
+		return err
+	})
 }
 
 func ActivateTest(testId string, db *sqlx.DB) error {
@@ -130,7 +245,8 @@ func ActivateTest(testId string, db *sqlx.DB) error {
 		SET active = 1
 		WHERE test_id = $1
 	`
-	_, err := db.Exec(q, testId)
-
-	return err
+	return withTestChange(testId, db, func(tx *sqlx.Tx) error {
+		_, err := tx.Exec(q, testId)
+		return err
+	})
 }
@@ -0,0 +1,28 @@
+package dao
+
+import (
+	"database/sql"
+	"github.com/jmoiron/sqlx"
+)
+
+// Ext is the database, or a transaction of it, for functions making changes that may have to be made together
+type Ext interface {
+	sqlx.Ext
+	Get(dest interface{}, query string, args ...interface{}) error
+	Select(dest interface{}, query string, args ...interface{}) error
+	NamedExec(query string, arg interface{}) (sql.Result, error)
+}
+
+// InTx runs f in a transaction, committed if f succeeds and rolled back otherwise
+func InTx(db *sqlx.DB, f func(tx *sqlx.Tx) error) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	err = f(tx)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
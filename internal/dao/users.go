@@ -0,0 +1,133 @@
+package dao
+
+import (
+	"github.com/jmoiron/sqlx"
+	"pingr"
+	"time"
+)
+
+func GetUsers(db *sqlx.DB) ([]pingr.User, error) {
+	q := `
+		SELECT * FROM users
+		ORDER BY username
+	`
+	users := []pingr.User{}
+	err := db.Select(&users, q)
+	return users, err
+}
+
+func GetUser(id string, db *sqlx.DB) (user pingr.User, err error) {
+	q := `
+		SELECT * FROM users
+		WHERE user_id = $1
+	`
+	err = db.Get(&user, q, id)
+	return
+}
+
+func GetUserByUsername(username string, db *sqlx.DB) (user pingr.User, err error) {
+	q := `
+		SELECT * FROM users
+		WHERE username = $1
+	`
+	err = db.Get(&user, q, username)
+	return
+}
+
+func PostUser(user pingr.User, db *sqlx.DB) error {
+	q := `
+		INSERT INTO users(user_id, username, password_hash, role, created_at)
+		VALUES (:user_id,:username,:password_hash,:role,:created_at)
+	`
+	_, err := db.NamedExec(q, user)
+	return err
+}
+
+func PutUser(user pingr.User, db *sqlx.DB) error {
+	q := `
+		UPDATE users
+		SET username = :username,
+		    password_hash = :password_hash,
+		    role = :role
+		WHERE user_id = :user_id
+	`
+	_, err := db.NamedExec(q, user)
+	return err
+}
+
+// DeleteUser deletes the user and its API tokens
+func DeleteUser(id string, db *sqlx.DB) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM api_tokens WHERE user_id = $1`, id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM users WHERE user_id = $1`, id)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAPITokens returns the tokens of a user, or of all users if userId is empty
+func GetAPITokens(userId string, db *sqlx.DB) ([]pingr.APIToken, error) {
+	q := `
+		SELECT * FROM api_tokens
+		WHERE $1 = '' OR user_id = $1
+		ORDER BY created_at
+	`
+	tokens := []pingr.APIToken{}
+	err := db.Select(&tokens, q, userId)
+	return tokens, err
+}
+
+func GetAPIToken(id string, db *sqlx.DB) (token pingr.APIToken, err error) {
+	q := `
+		SELECT * FROM api_tokens
+		WHERE token_id = $1
+	`
+	err = db.Get(&token, q, id)
+	return
+}
+
+func GetAPITokenByHash(hash string, db *sqlx.DB) (token pingr.APIToken, err error) {
+	q := `
+		SELECT * FROM api_tokens
+		WHERE token_hash = $1
+	`
+	err = db.Get(&token, q, hash)
+	return
+}
+
+func PostAPIToken(token pingr.APIToken, db *sqlx.DB) error {
+	q := `
+		INSERT INTO api_tokens(token_id, token_name, user_id, scope, token_hash, created_at, expires_at)
+		VALUES (:token_id,:token_name,:user_id,:scope,:token_hash,:created_at,:expires_at)
+	`
+	_, err := db.NamedExec(q, token)
+	return err
+}
+
+func SetAPITokenUsed(id string, used time.Time, db *sqlx.DB) error {
+	q := `
+		UPDATE api_tokens
+		SET last_used = $1
+		WHERE token_id = $2
+	`
+	_, err := db.Exec(q, used, id)
+	return err
+}
+
+func DeleteAPIToken(id string, db *sqlx.DB) error {
+	q := `
+		DELETE FROM api_tokens
+		WHERE token_id = $1
+	`
+	_, err := db.Exec(q, id)
+	return err
+}
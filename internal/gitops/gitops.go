@@ -0,0 +1,190 @@
+package gitops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"pingr"
+	"pingr/internal/bus"
+	"pingr/internal/config"
+	"pingr/internal/dao"
+	"sort"
+	"strings"
+)
+
+// Declared is the content of the configuration directory, in the same shapes as the API
+type Declared struct {
+	Tests        []pingr.GenericTest `json:"tests"`
+	Contacts     []pingr.Contact     `json:"contacts"`
+	TestContacts []pingr.TestContact `json:"test_contacts"`
+}
+
+// Apply loads the configuration directory, if set, and reconciles the database to match it. Nothing is changed if
+// any of it fails. It is called at startup, and again on SIGHUP once the config has been reloaded
+func Apply(db *sqlx.DB, buz *bus.Bus) {
+	cfg := config.Get()
+	if cfg.ConfigDir == "" {
+		return
+	}
+	logger := log.WithField("dir", cfg.ConfigDir)
+
+	d, err := Load(cfg.ConfigDir)
+	if err != nil {
+		logger.WithError(err).Error("could not load the configuration directory, nothing was changed")
+		return
+	}
+
+	var s summary
+	err = dao.InTx(db, func(tx *sqlx.Tx) error {
+		s, err = reconcile(d, cfg.ConfigStrict, tx)
+		return err
+	})
+	if err != nil {
+		logger.WithError(err).Error("could not reconcile the configuration directory, nothing was changed")
+		return
+	}
+	if s.tests > 0 {
+		// Picked up by the scheduler within seconds anyway if the bus is full
+		_ = buz.Publish("changes", nil)
+	}
+	logger.WithField("created", s.created).WithField("updated", s.updated).WithField("deleted", s.deleted).
+		Info("Configuration directory reconciled")
+}
+
+// Load reads and validates all .yaml, .yml and .json files in the directory, in order of their names
+func Load(dir string) (Declared, error) {
+	var d Declared
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return d, err
+	}
+	var names []string
+	for _, f := range files {
+		switch strings.ToLower(filepath.Ext(f.Name())) {
+		case ".yaml", ".yml", ".json":
+			if !f.IsDir() {
+				names = append(names, f.Name())
+			}
+		}
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return d, err
+		}
+		err = parse(data, &d)
+		if err != nil {
+			return d, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	return d, d.Validate()
+}
+
+// parse appends the objects of each YAML document, JSON being a subset of YAML, to d
+func parse(data []byte, d *Declared) error {
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var doc interface{}
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if doc == nil {
+			continue // Empty document
+		}
+
+		// Through JSON to use the same shapes, and unmarshalling of blobs, as the API
+		j, err := json.Marshal(toJSON(doc))
+		if err != nil {
+			return err
+		}
+		var part Declared
+		jdec := json.NewDecoder(bytes.NewReader(j))
+		jdec.DisallowUnknownFields()
+		err = jdec.Decode(&part)
+		if err != nil {
+			return err
+		}
+		d.Tests = append(d.Tests, part.Tests...)
+		d.Contacts = append(d.Contacts, part.Contacts...)
+		d.TestContacts = append(d.TestContacts, part.TestContacts...)
+	}
+}
+
+// toJSON converts the maps decoded from YAML, keyed by interface{}, to maps that can be marshalled as JSON
+func toJSON(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			m[fmt.Sprint(k)] = toJSON(e)
+		}
+		return m
+	case []interface{}:
+		for i, e := range v {
+			v[i] = toJSON(e)
+		}
+		return v
+	}
+	return v
+}
+
+// Validate checks that all objects are valid and have unique ids, and that test contacts refer to declared tests
+func (d Declared) Validate() error {
+	tests := map[string]bool{}
+	for _, t := range d.Tests {
+		if t.TestId == "" {
+			return fmt.Errorf("test %q: missing test_id", t.TestName)
+		}
+		if tests[t.TestId] {
+			return fmt.Errorf("test %s: declared more than once", t.TestId)
+		}
+		tests[t.TestId] = true
+		if !t.Validate() {
+			return fmt.Errorf("test %s: invalid test", t.TestId)
+		}
+	}
+
+	contacts := map[string]bool{}
+	for _, c := range d.Contacts {
+		if c.ContactId == "" {
+			return fmt.Errorf("contact %q: missing contact_id", c.ContactName)
+		}
+		if contacts[c.ContactId] {
+			return fmt.Errorf("contact %s: declared more than once", c.ContactId)
+		}
+		contacts[c.ContactId] = true
+		if !c.Validate() {
+			return fmt.Errorf("contact %s: invalid contact", c.ContactId)
+		}
+	}
+
+	testContacts := map[pingr.TestContact]bool{}
+	for _, tc := range d.TestContacts {
+		if !tc.Validate() {
+			return fmt.Errorf("test contact %s/%s: invalid test contact", tc.TestId, tc.ContactId)
+		}
+		if !tests[tc.TestId] {
+			return fmt.Errorf("test contact %s/%s: test is not declared", tc.TestId, tc.ContactId)
+		}
+		key := pingr.TestContact{TestId: tc.TestId, ContactId: tc.ContactId}
+		if testContacts[key] {
+			return fmt.Errorf("test contact %s/%s: declared more than once", tc.TestId, tc.ContactId)
+		}
+		testContacts[key] = true
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package gitops
+
+import (
+	"testing"
+)
+
+const testsYAML = `
+tests:
+  - test_id: frontpage
+    test_name: Frontpage
+    test_type: HTTP
+    url: https://example.com
+    interval: 60
+    timeout: 10
+    tags: [customer-x]
+    blob:
+      req_method: GET
+      res_status: 200
+---
+test_contacts:
+  - test_id: frontpage
+    contact_id: ops
+    threshold: 1
+`
+
+const contactsJSON = `{"contacts": [{"contact_id": "ops", "contact_name": "Ops", "contact_type": "http", "contact_url": "https://example.com/hook"}]}`
+
+func TestParse(t *testing.T) {
+	var d Declared
+	if err := parse([]byte(testsYAML), &d); err != nil {
+		t.Fatal(err)
+	}
+	if err := parse([]byte(contactsJSON), &d); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(d.Tests) != 1 || len(d.Contacts) != 1 || len(d.TestContacts) != 1 {
+		t.Fatalf("expected 1 test, contact and test contact, got %d, %d and %d", len(d.Tests), len(d.Contacts), len(d.TestContacts))
+	}
+	test := d.Tests[0]
+	if test.Interval != 60 || len(test.Tags) != 1 {
+		t.Logf("unexpected test %+v", test)
+		t.Fail()
+	}
+	if exp := `{"req_method":"GET","res_status":200}`; string(test.Blob) != exp {
+		t.Logf("expected blob %s, got %s", exp, test.Blob)
+		t.Fail()
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, c := range []string{
+		"tests: [{test_id: a, intervall: 60}]",
+		"tests: {test_id: a}",
+		"contacts: [{contact_id: a",
+	} {
+		var d Declared
+		if err := parse([]byte(c), &d); err == nil {
+			t.Logf("expected %q to be invalid", c)
+			t.Fail()
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, c := range []string{
+		contactsJSON + "\n---\ncontacts: [{contact_id: ops, contact_name: Ops, contact_type: http, contact_url: x}]",
+		"test_contacts: [{test_id: frontpage, contact_id: ops, threshold: 1}]",
+		"tests: [{test_name: No id, test_type: HTTP, url: x, interval: 60, timeout: 10}]",
+	} {
+		var d Declared
+		if err := parse([]byte(c), &d); err != nil {
+			t.Fatal(err)
+		}
+		if err := d.Validate(); err == nil {
+			t.Logf("expected %q to be invalid", c)
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,270 @@
+package gitops
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"pingr"
+	"pingr/internal/dao"
+	"sort"
+	"time"
+)
+
+type summary struct {
+	created int
+	updated int
+	deleted int
+	tests   int // tests created, updated or deleted
+}
+
+// reconcile makes the database match the declared objects. Objects no longer declared are deleted if they were
+// created through the configuration directory, or in strict mode, if not declared at all
+func reconcile(d Declared, strict bool, db dao.Ext) (summary, error) {
+	var s summary
+
+	declaredContacts := map[string]bool{}
+	for _, c := range d.Contacts {
+		declaredContacts[c.ContactId] = true
+	}
+	declaredTests := map[string]bool{}
+	for _, t := range d.Tests {
+		declaredTests[t.TestId] = true
+	}
+
+	// Test contacts may refer to contacts created through the API as well
+	for _, tc := range d.TestContacts {
+		if declaredContacts[tc.ContactId] {
+			continue
+		}
+		_, err := dao.GetContact(tc.ContactId, db)
+		if err != nil {
+			return s, fmt.Errorf("test contact %s/%s: contact is not declared: %v", tc.TestId, tc.ContactId, err)
+		}
+		if strict {
+			return s, fmt.Errorf("test contact %s/%s: contact is not declared", tc.TestId, tc.ContactId)
+		}
+	}
+
+	managedContacts, err := dao.GetManaged(dao.ManagedContact, db)
+	if err != nil {
+		return s, err
+	}
+	for _, c := range d.Contacts {
+		err = reconcileContact(c, managedContacts[c.ContactId], &s, db)
+		if err != nil {
+			return s, fmt.Errorf("contact %s: %v", c.ContactId, err)
+		}
+	}
+
+	managedTests, err := dao.GetManaged(dao.ManagedTest, db)
+	if err != nil {
+		return s, err
+	}
+	for _, t := range d.Tests {
+		err = reconcileTest(t, managedTests[t.TestId], &s, db)
+		if err != nil {
+			return s, fmt.Errorf("test %s: %v", t.TestId, err)
+		}
+	}
+
+	testContacts := map[string][]pingr.TestContact{}
+	for _, tc := range d.TestContacts {
+		testContacts[tc.TestId] = append(testContacts[tc.TestId], tc)
+	}
+	for _, t := range d.Tests {
+		err = reconcileTestContacts(t.TestId, testContacts[t.TestId], db)
+		if err != nil {
+			return s, fmt.Errorf("test contacts of %s: %v", t.TestId, err)
+		}
+	}
+
+	tests, err := dao.GetRawTests(db)
+	if err != nil {
+		return s, err
+	}
+	for _, t := range tests {
+		_, managed := managedTests[t.TestId]
+		if declaredTests[t.TestId] || !(managed || strict) {
+			continue
+		}
+		err = dao.PurgeTest(t.TestId, db)
+		if err != nil {
+			return s, fmt.Errorf("test %s: %v", t.TestId, err)
+		}
+		s.deleted++
+		s.tests++
+	}
+	for testId := range managedTests {
+		if !declaredTests[testId] {
+			err = dao.DeleteManaged(dao.ManagedTest, testId, db)
+			if err != nil {
+				return s, err
+			}
+		}
+	}
+
+	contacts, err := dao.GetContacts(db)
+	if err != nil {
+		return s, err
+	}
+	for _, c := range contacts {
+		_, managed := managedContacts[c.ContactId]
+		if declaredContacts[c.ContactId] || !(managed || strict) {
+			continue
+		}
+		err = dao.DeleteContactTests(c.ContactId, db)
+		if err != nil {
+			return s, fmt.Errorf("contact %s: %v", c.ContactId, err)
+		}
+		err = dao.DeleteContact(c.ContactId, db)
+		if err != nil {
+			return s, fmt.Errorf("contact %s: %v", c.ContactId, err)
+		}
+		s.deleted++
+	}
+	for contactId := range managedContacts {
+		if !declaredContacts[contactId] {
+			err = dao.DeleteManaged(dao.ManagedContact, contactId, db)
+			if err != nil {
+				return s, err
+			}
+		}
+	}
+
+	return s, nil
+}
+
+func reconcileContact(c pingr.Contact, managedHash string, s *summary, db dao.Ext) error {
+	h, err := hash(c)
+	if err != nil {
+		return err
+	}
+
+	current, err := dao.GetContact(c.ContactId, db)
+	switch {
+	case err == sql.ErrNoRows:
+		err = dao.PostContact(c, db)
+		s.created++
+	case err != nil:
+		return err
+	case current != c || managedHash != h:
+		err = dao.PutContact(c, db)
+		s.updated++
+	}
+	if err != nil {
+		return err
+	}
+
+	return dao.PutManaged(dao.ManagedContact, c.ContactId, h, db)
+}
+
+// reconcileTest creates, or updates, the test. Declarations are hashed as the stored test can not be compared
+// to its declaration once credentials are sealed, a test is updated if either its declaration has changed or
+// the stored test differs from it, e.g. when edited through the API
+func reconcileTest(t pingr.GenericTest, managedHash string, s *summary, db dao.Ext) error {
+	t.Tags = append([]string{}, t.Tags...)
+	sort.Strings(t.Tags)
+	h, err := hash(t)
+	if err != nil {
+		return err
+	}
+
+	current, err := dao.GetRawTest(t.TestId, db)
+	switch {
+	case err == sql.ErrNoRows:
+		t.CreatedAt = time.Now()
+		err = t.MaskSensitiveInfo(pingr.POST, nil)
+		if err != nil {
+			return err
+		}
+		err = dao.PostTest(t, db)
+		s.created++
+		s.tests++
+	case err != nil:
+		return err
+	default:
+		t.CreatedAt = current.CreatedAt
+		var same bool
+		same, err = sameTest(t, current)
+		if err != nil {
+			return err
+		}
+		if same && managedHash == h {
+			break
+		}
+		err = t.MaskSensitiveInfo(pingr.PUT, &current)
+		if err != nil {
+			return err
+		}
+		err = dao.PutTest(t, db)
+		if err != nil {
+			return err
+		}
+		s.updated++
+		s.tests++
+	}
+	if err != nil {
+		return err
+	}
+
+	return dao.PutManaged(dao.ManagedTest, t.TestId, h, db)
+}
+
+// reconcileTestContacts replaces the contacts of the test, unless they are the declared ones already
+func reconcileTestContacts(testId string, declared []pingr.TestContact, db dao.Ext) error {
+	current, err := dao.GetTestContacts(testId, db)
+	if err != nil {
+		return err
+	}
+
+	same := len(current) == len(declared)
+	for _, tc := range declared {
+		found := false
+		for _, c := range current {
+			found = found || c == tc
+		}
+		same = same && found
+	}
+	if same {
+		return nil
+	}
+
+	err = dao.DeleteTestContacts(testId, db)
+	if err != nil {
+		return err
+	}
+	for _, tc := range declared {
+		err = dao.PostTestContact(tc, db)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sameTest compares the tests as returned by the API, without credentials
+func sameTest(a pingr.GenericTest, b pingr.GenericTest) (bool, error) {
+	var masked [2][]byte
+	for i, t := range []pingr.GenericTest{a, b} {
+		err := t.MaskSensitiveInfo(pingr.GET, nil)
+		if err != nil {
+			return false, err
+		}
+		masked[i], err = json.Marshal(t)
+		if err != nil {
+			return false, err
+		}
+	}
+	return string(masked[0]) == string(masked[1]), nil
+}
+
+func hash(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
@@ -0,0 +1,93 @@
+package ha
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"pingr/internal/config"
+	"pingr/internal/dao"
+	"sync/atomic"
+	"time"
+)
+
+const leaseName = "scheduler"
+
+var leader int32
+
+// IsLeader reports whether this instance is the one running tests, always true unless HA is enabled
+func IsLeader() bool {
+	return !config.Get().HA || atomic.LoadInt32(&leader) == 1
+}
+
+// Elect keeps trying to take, or renew, the leader lease until closing, calling lead whenever leadership
+// is gained or lost. Leadership is given up once the lease could not be renewed for its full length,
+// e.g. if the database can't be reached, and released on closing to let another instance take over right away
+func Elect(closing <-chan struct{}, db *sqlx.DB, lead func(bool)) {
+	cfg := config.Get()
+	nodeId := cfg.HANodeId
+	if nodeId == "" {
+		hostname, _ := os.Hostname()
+		nodeId = fmt.Sprintf("%s-%s", hostname, uuid.New().String()[:8])
+	}
+	length := cfg.HALeaseLength
+	log.WithField("node_id", nodeId).Info("Starting leader election")
+
+	var renewed time.Time
+	setLeader := func(l bool) {
+		if IsLeader() == l {
+			return
+		}
+		if l {
+			atomic.StoreInt32(&leader, 1)
+			log.WithField("node_id", nodeId).Info("Became leader")
+		} else {
+			atomic.StoreInt32(&leader, 0)
+			log.WithField("node_id", nodeId).Warn("Lost leadership")
+		}
+		lead(l)
+	}
+
+	for {
+		now := time.Now()
+		acquired, err := dao.AcquireLease(leaseName, nodeId, now.Add(length), db)
+		switch {
+		case err != nil:
+			log.Error("could not acquire leader lease: ", err)
+			if IsLeader() && now.Sub(renewed) > length {
+				setLeader(false)
+			}
+		case acquired:
+			renewed = now
+			setLeader(true)
+		default:
+			setLeader(false)
+		}
+
+		select {
+		case <-time.After(length / 3):
+		case <-closing:
+			if IsLeader() {
+				atomic.StoreInt32(&leader, 0)
+				err := dao.ReleaseLease(leaseName, nodeId, db)
+				if err != nil {
+					log.Error("could not release leader lease: ", err)
+				}
+			}
+			return
+		}
+	}
+}
+
+// LeaderOnly rejects requests to instances that are not the leader, for endpoints whose data is only
+// handled by the instance running the tests, e.g. pushes and agent results
+func LeaderOnly(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if !IsLeader() {
+			return c.String(503, "not the leader")
+		}
+		return next(c)
+	}
+}
@@ -0,0 +1,288 @@
+package ingest
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	log "github.com/sirupsen/logrus"
+	"net"
+	"pingr"
+	"pingr/internal/bus"
+	"pingr/internal/config"
+	"pingr/internal/dao"
+	"pingr/internal/ha"
+	"pingr/internal/push"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	routeInterval  = 30 * time.Second
+	flushInterval  = time.Second
+	leaderInterval = time.Second
+
+	// Max number of lines kept per test while its worker is busy
+	maxPending = 10000
+)
+
+type route struct {
+	testId string
+	prefix string
+	auth   pingr.PushAuth
+}
+
+// Ingest receives StatsD and Graphite lines and routes them to LinePush tests by metric prefix
+type Ingest struct {
+	db  *sqlx.DB
+	buz *bus.Bus
+
+	mu      sync.Mutex
+	routes  []route
+	pending map[string][]push.Line
+}
+
+func Start(closing <-chan struct{}, db *sqlx.DB, buz *bus.Bus) {
+	cfg := config.Get()
+	if cfg.StatsDAddr == "" && cfg.GraphiteAddr == "" {
+		return
+	}
+
+	i := &Ingest{
+		db:      db,
+		buz:     buz,
+		pending: map[string][]push.Line{},
+	}
+	i.updateRoutes()
+
+	go i.listenWhileLeader(closing)
+	go i.maintainRoutes(closing)
+	go i.flush(closing)
+}
+
+// listenWhileLeader only listens for lines while this instance is the leader, as only the leader runs the tests.
+// Lines sent to other instances are refused rather than lost, for TCP at least
+func (i *Ingest) listenWhileLeader(closing <-chan struct{}) {
+	cfg := config.Get()
+	var stop chan struct{}
+	for {
+		leader := ha.IsLeader()
+		switch {
+		case leader && stop == nil:
+			stop = make(chan struct{})
+			if cfg.StatsDAddr != "" {
+				i.listen(stop, cfg.StatsDAddr, push.ParseStatsD)
+			}
+			if cfg.GraphiteAddr != "" {
+				i.listen(stop, cfg.GraphiteAddr, push.ParseGraphite)
+			}
+		case !leader && stop != nil:
+			log.Info("No longer the leader, not listening for lines")
+			close(stop)
+			stop = nil
+			i.mu.Lock()
+			i.pending = map[string][]push.Line{}
+			i.mu.Unlock()
+		}
+
+		select {
+		case <-time.After(leaderInterval):
+		case <-closing:
+			if stop != nil {
+				close(stop)
+			}
+			return
+		}
+	}
+}
+
+func (i *Ingest) listen(closing <-chan struct{}, addr string, parse func(string) (push.Line, error)) {
+	packetConn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		log.Error(fmt.Sprintf("could not listen for lines on udp %s: %v", addr, err))
+	} else {
+		log.Info(fmt.Sprintf("Listening for lines on udp %s", addr))
+		go i.serveUDP(packetConn, parse)
+		go func() {
+			<-closing
+			_ = packetConn.Close()
+		}()
+	}
+
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Error(fmt.Sprintf("could not listen for lines on tcp %s: %v", addr, err))
+	} else {
+		log.Info(fmt.Sprintf("Listening for lines on tcp %s", addr))
+		go i.serveTCP(closing, listener, parse)
+		go func() {
+			<-closing
+			_ = listener.Close()
+		}()
+	}
+}
+
+func (i *Ingest) serveUDP(conn net.PacketConn, parse func(string) (push.Line, error)) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return // Closed
+		}
+		for _, raw := range strings.Split(string(buf[:n]), "\n") {
+			i.receive(raw, addr, parse)
+		}
+	}
+}
+
+func (i *Ingest) serveTCP(closing <-chan struct{}, listener net.Listener, parse func(string) (push.Line, error)) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return // Closed
+		}
+		go func() {
+			defer conn.Close()
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				select {
+				case <-closing:
+					_ = conn.Close()
+				case <-done:
+				}
+			}()
+
+			scanner := bufio.NewScanner(conn)
+			for scanner.Scan() {
+				i.receive(scanner.Text(), conn.RemoteAddr(), parse)
+			}
+		}()
+	}
+}
+
+func (i *Ingest) receive(raw string, addr net.Addr, parse func(string) (push.Line, error)) {
+	if strings.TrimSpace(raw) == "" {
+		return
+	}
+	line, err := parse(raw)
+	if err != nil {
+		log.Debug(err)
+		return
+	}
+
+	host, _, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		host = addr.String()
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, r := range i.routes {
+		if !strings.HasPrefix(line.Name, r.prefix) || !r.auth.AllowsIP(host) {
+			continue
+		}
+		lines := append(i.pending[r.testId], line)
+		if len(lines) > maxPending {
+			lines = lines[len(lines)-maxPending:]
+		}
+		i.pending[r.testId] = lines
+	}
+}
+
+// flush publishes the received lines to the workers, lines are kept until a worker is ready to receive them
+func (i *Ingest) flush(closing <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(flushInterval):
+		case <-closing:
+			return
+		}
+
+		i.mu.Lock()
+		for testId, lines := range i.pending {
+			data, err := json.Marshal(lines)
+			if err != nil {
+				log.Error("could not marshal lines: ", err)
+				delete(i.pending, testId)
+				continue
+			}
+			err = i.buz.Publish(fmt.Sprintf("push:%s", testId), data)
+			if err != nil {
+				continue // Worker is busy, try again next flush
+			}
+			delete(i.pending, testId)
+		}
+		i.mu.Unlock()
+	}
+}
+
+func (i *Ingest) maintainRoutes(closing <-chan struct{}) {
+	for {
+		select {
+		case <-time.After(routeInterval):
+			i.updateRoutes()
+		case <-closing:
+			return
+		}
+	}
+}
+
+func (i *Ingest) updateRoutes() {
+	tests, err := dao.GetRawTests(i.db)
+	if err != nil {
+		log.Error("could not get tests for line routing: ", err)
+		return
+	}
+
+	var routes []route
+	for _, test := range tests {
+		if test.TestType != "LinePush" || !test.Active {
+			continue
+		}
+		impl, err := test.Impl()
+		if err != nil {
+			continue
+		}
+		lineTest, ok := impl.(pingr.LinePushTest)
+		if !ok {
+			continue
+		}
+
+		auth, err := dao.GetPushAuth(test.TestId, i.db)
+		if err != nil && err != sql.ErrNoRows {
+			log.Error("could not get push authentication for line routing: ", err)
+			continue
+		}
+		// Lines carry no token or signature, allowed ips are the only authentication of them
+		if config.Get().PushAuthRequired && len(auth.IPs()) == 0 {
+			continue
+		}
+		routes = append(routes, route{
+			testId: test.TestId,
+			prefix: lineTest.Blob.Prefix,
+			auth:   auth,
+		})
+	}
+
+	i.mu.Lock()
+	i.routes = routes
+	// Lines of tests no longer routed to, e.g. deleted or paused, are dropped rather than published to a closed test
+	for testId := range i.pending {
+		if !routed(testId, routes) {
+			delete(i.pending, testId)
+		}
+	}
+	i.mu.Unlock()
+}
+
+func routed(testId string, routes []route) bool {
+	for _, r := range routes {
+		if r.testId == testId {
+			return true
+		}
+	}
+	return false
+}
@@ -39,6 +39,9 @@ func EchoMiddleware(skipper middleware.Skipper) echo.MiddlewareFunc {
 			entry = entry.WithField("method", req.Method)
 			entry = entry.WithField("host", req.Host)
 			entry = entry.WithField("status", res.Status)
+			if user, ok := c.Get("User").(string); ok {
+				entry = entry.WithField("user", user) // Set by the authentication
+			}
 
 			if err != nil {
 				entry.Error()
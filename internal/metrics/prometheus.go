@@ -16,3 +16,30 @@ var logEntires = promauto.NewCounter(prometheus.CounterOpts{
 	Name: "pingr_log_entries",
 	Help: "The total number of log entries made by the service",
 })
+
+var SchedulerQueueInc = schedulerQueue.Inc
+var SchedulerQueueDec = schedulerQueue.Dec
+var schedulerQueue = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pingr_scheduler_queue_depth",
+	Help: "The number of tests waiting for a free slot to run in",
+})
+
+var SchedulerRunningInc = schedulerRunning.Inc
+var SchedulerRunningDec = schedulerRunning.Dec
+var schedulerRunning = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "pingr_scheduler_running_tests",
+	Help: "The number of tests currently running",
+})
+
+var SchedulerLagObserve = schedulerLag.Observe
+var schedulerLag = promauto.NewHistogram(prometheus.HistogramOpts{
+	Name:    "pingr_scheduler_lag_seconds",
+	Help:    "The time tests have been delayed past their scheduled time, waiting for a free slot",
+	Buckets: []float64{0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+})
+
+var HungProbesInc = hungProbes.Inc
+var hungProbes = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "pingr_scheduler_hung_probes",
+	Help: "The total number of probes that did not return within their deadline and were abandoned",
+})
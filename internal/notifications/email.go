@@ -15,8 +15,9 @@ import (
 	"time"
 )
 
-var (
-	h = hermes.Hermes{
+// newHermes is called on use, rather than on init, so that the config is not required to import the package
+func newHermes() *hermes.Hermes {
+	return &hermes.Hermes{
 		Product: hermes.Product{
 			Name: "Pingr",
 			Link: config.Get().BaseUrl,
@@ -25,7 +26,7 @@ var (
 			Copyright: "https://github.com/itsy-sh/pingr",
 		},
 	}
-)
+}
 
 func SendEmail(receivers []string, test pingr.BaseTest, testErr error, db *sqlx.DB) error {
 	for i := range receivers {
@@ -57,34 +58,11 @@ func SendEmail(receivers []string, test pingr.BaseTest, testErr error, db *sqlx.
 }
 
 func getEmailBody(test pingr.BaseTest, testErr error, db *sqlx.DB) ([]byte, error) {
-	logs, err := dao.GetTestLogsLimited(test.TestId, 10, db)
+	hermesTable, err := getLogTable(test, db)
 	if err != nil {
 		return nil, err
 	}
 
-	var table [][]hermes.Entry
-	for _, log := range logs {
-		var row []hermes.Entry
-		row = append(row, hermes.Entry{Key: "Created at", Value: log.CreatedAt.Local().Format("2006-01-02T15:04:05")})
-		row = append(row, hermes.Entry{Key: "Status", Value: log.StatusName})
-		row = append(row, hermes.Entry{Key: "Error message", Value: log.Message})
-		row = append(row, hermes.Entry{Key: "Response time", Value: log.ResponseTime.Round(time.Millisecond).String()})
-		table = append(table, row)
-	}
-
-	hermesTable := hermes.Table{
-		Data: table,
-		Columns: hermes.Columns{
-			// Custom style for each rows
-			CustomWidth: map[string]string{
-				"Created at":    "20%",
-				"Status":        "10%",
-				"Error message": "60%",
-				"Response time": "10%",
-			},
-		},
-	}
-
 	var body hermes.Email
 	if testErr != nil {
 		body = hermes.Email{
@@ -130,9 +108,112 @@ func getEmailBody(test pingr.BaseTest, testErr error, db *sqlx.DB) ([]byte, erro
 		}
 	}
 
-	bodyString, err := h.GenerateHTML(body)
+	bodyString, err := newHermes().GenerateHTML(body)
 	if err != nil {
 		return nil, err
 	}
 	return []byte(bodyString), nil
 }
+
+// SendFlappingEmail notifies that a test started, or stopped, flapping
+func SendFlappingEmail(receivers []string, test pingr.BaseTest, flapping bool, stateChange float64, db *sqlx.DB) error {
+	if flapping {
+		return sendNotice(receivers, test, fmt.Sprintf("Flapping: %s", test.TestName), "One of your tests is flapping", []string{
+			fmt.Sprintf("The test: %s is alternating between success and failure, %.0f%% state change", test.TestName, stateChange),
+			"You will not be notified of each failure until it has stopped flapping",
+		}, db)
+	}
+	return sendNotice(receivers, test, fmt.Sprintf("Stopped flapping: %s", test.TestName), "Test stopped flapping", []string{
+		fmt.Sprintf("The test: %s is no longer flapping, %.0f%% state change", test.TestName, stateChange),
+	}, db)
+}
+
+// SendDegradedEmail notifies that a test started, or stopped, responding slower than its threshold
+func SendDegradedEmail(receivers []string, test pingr.BaseTest, degraded bool, rt time.Duration, db *sqlx.DB) error {
+	if degraded {
+		return sendNotice(receivers, test, fmt.Sprintf("Degraded: %s", test.TestName), "One of your tests is degraded", []string{
+			fmt.Sprintf("The test: %s is responding slowly, response time: %s", test.TestName, rt.Round(time.Millisecond)),
+		}, db)
+	}
+	return sendNotice(receivers, test, fmt.Sprintf("No longer degraded: %s", test.TestName), "Test no longer degraded", []string{
+		fmt.Sprintf("The test: %s is responding normally again, response time: %s", test.TestName, rt.Round(time.Millisecond)),
+	}, db)
+}
+
+func sendNotice(receivers []string, test pingr.BaseTest, subject string, title string, intros []string, db *sqlx.DB) error {
+	for i := range receivers {
+		// add '+test-name' to receivers
+		atIndex := strings.Index(receivers[i], "@")
+		receivers[i] = receivers[i][:atIndex] + "+" + slug.Make(test.TestName) + receivers[i][atIndex:]
+	}
+
+	e := &email.Email{
+		To:      receivers,
+		From:    fmt.Sprintf("Pingr <%s>", config.Get().SMTPUsername),
+		Subject: subject,
+		Headers: textproto.MIMEHeader{},
+	}
+
+	hermesTable, err := getLogTable(test, db)
+	if err != nil {
+		return err
+	}
+
+	body := hermes.Email{
+		Body: hermes.Body{
+			Title:  title,
+			Intros: intros,
+			Actions: []hermes.Action{
+				{
+					Button: hermes.Button{
+						Color: "#f7a35c", // Optional action button color
+						Text:  "View test",
+						Link:  config.Get().BaseUrl + "/tests/" + test.TestId,
+					},
+				},
+			},
+			Table:     hermesTable,
+			Signature: "Happy troubleshooting",
+		},
+	}
+
+	bodyString, err := newHermes().GenerateHTML(body)
+	if err != nil {
+		return err
+	}
+	e.HTML = []byte(bodyString)
+
+	a := smtp.PlainAuth("", config.Get().SMTPUsername, config.Get().SMTPPassword, config.Get().SMTPHost)
+	return e.Send(fmt.Sprintf("%s:%d", config.Get().SMTPHost, config.Get().SMTPPort), a)
+}
+
+func getLogTable(test pingr.BaseTest, db *sqlx.DB) (hermes.Table, error) {
+	logs, err := dao.GetTestLogsLimited(test.TestId, 10, db)
+	if err != nil {
+		return hermes.Table{}, err
+	}
+
+	var table [][]hermes.Entry
+	for _, log := range logs {
+		var row []hermes.Entry
+		row = append(row, hermes.Entry{Key: "Created at", Value: log.CreatedAt.Local().Format("2006-01-02T15:04:05")})
+		row = append(row, hermes.Entry{Key: "Status", Value: log.StatusName})
+		row = append(row, hermes.Entry{Key: "Error message", Value: log.Message})
+		row = append(row, hermes.Entry{Key: "Response time", Value: log.ResponseTime.Round(time.Millisecond).String()})
+		table = append(table, row)
+	}
+
+	hermesTable := hermes.Table{
+		Data: table,
+		Columns: hermes.Columns{
+			// Custom style for each rows
+			CustomWidth: map[string]string{
+				"Created at":    "20%",
+				"Status":        "10%",
+				"Error message": "60%",
+				"Response time": "10%",
+			},
+		},
+	}
+	return hermesTable, nil
+}
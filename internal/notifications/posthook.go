@@ -37,6 +37,10 @@ func PostHook(urls []string, test pingr.BaseTest, testErr error, statusCode uint
 		postMsg.StatusName = "Test timed out"
 	} else if statusCode == 1 {
 		postMsg.StatusName = "Test successful"
+	} else if statusCode == 10 {
+		postMsg.StatusName = "Test flapping"
+	} else if statusCode == 11 {
+		postMsg.StatusName = "Test degraded"
 	}
 
 	client := http.Client{Timeout: 20 * time.Second}
@@ -0,0 +1,219 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"pingr"
+	"pingr/internal/sec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Logins have to be completed within LoginLength of being started
+const LoginLength = 10 * time.Minute
+
+// Provider signs users in through the authorization code flow, with PKCE, of an OpenID Connect identity provider
+type Provider struct {
+	Issuer       string
+	ClientId     string
+	ClientSecret string // Empty for public clients
+	RedirectURL  string
+	Scopes       []string
+
+	http *http.Client
+
+	mu            sync.Mutex
+	discovery     *discovery
+	keys          map[string]interface{} // *rsa.PublicKey or *ecdsa.PublicKey by key id
+	keysFetchedAt time.Time
+}
+
+type discovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+	EndSessionEndpoint    string `json:"end_session_endpoint"`
+}
+
+func New(issuer string, clientId string, clientSecret string, redirectURL string, scopes []string) *Provider {
+	return &Provider{
+		Issuer:       strings.TrimRight(issuer, "/"),
+		ClientId:     clientId,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		http:         &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Login is the state of a sign in between being sent to the identity provider and coming back
+type Login struct {
+	State     string    `json:"state"`
+	Nonce     string    `json:"nonce"`
+	Verifier  string    `json:"verifier"` // PKCE code verifier
+	Redirect  string    `json:"redirect"` // Where to go once signed in
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewLogin(redirect string) (Login, error) {
+	l := Login{Redirect: redirect, ExpiresAt: time.Now().Add(LoginLength)}
+	for _, v := range []*string{&l.State, &l.Nonce, &l.Verifier} {
+		var err error
+		*v, err = sec.NewToken()
+		if err != nil {
+			return l, err
+		}
+	}
+	return l, nil
+}
+
+// AuthURL is where the user is sent to sign in
+func (p *Provider) AuthURL(ctx context.Context, l Login) (string, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return "", err
+	}
+	challenge := sha256.Sum256([]byte(l.Verifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientId},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {l.State},
+		"nonce":                 {l.Nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// EndSessionURL is where the user is sent to sign out of the identity provider, empty if it has no such endpoint
+func (p *Provider) EndSessionURL(ctx context.Context, redirect string) string {
+	d, err := p.getDiscovery(ctx)
+	if err != nil || d.EndSessionEndpoint == "" {
+		return ""
+	}
+	q := url.Values{"client_id": {p.ClientId}, "post_logout_redirect_uri": {redirect}}
+	return d.EndSessionEndpoint + "?" + q.Encode()
+}
+
+// Exchange redeems the code of a login for tokens, returning the claims of the verified ID token
+func (p *Provider) Exchange(ctx context.Context, code string, l Login) (Claims, error) {
+	d, err := p.getDiscovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientId},
+		"code_verifier": {l.Verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientId), url.QueryEscape(p.ClientSecret))
+	}
+
+	res, err := p.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	var tokens struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	_ = json.Unmarshal(body, &tokens)
+	if res.StatusCode != 200 {
+		if tokens.Error != "" {
+			return nil, fmt.Errorf("token endpoint: %s %s", tokens.Error, tokens.ErrorDescription)
+		}
+		return nil, fmt.Errorf("token endpoint: status %d", res.StatusCode)
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token endpoint: no id_token in response")
+	}
+
+	return p.Verify(ctx, tokens.IDToken, l.Nonce)
+}
+
+func (p *Provider) getDiscovery(ctx context.Context) (discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return *p.discovery, nil
+	}
+
+	var d discovery
+	err := p.getJSON(ctx, p.Issuer+"/.well-known/openid-configuration", &d)
+	if err != nil {
+		return d, fmt.Errorf("discovery: %v", err)
+	}
+	if strings.TrimRight(d.Issuer, "/") != p.Issuer {
+		return d, fmt.Errorf("discovery: issuer %q does not match %q", d.Issuer, p.Issuer)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return d, errors.New("discovery: missing endpoints")
+	}
+	p.discovery = &d
+	return d, nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	res, err := p.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 {
+		return fmt.Errorf("GET %s: status %d", u, res.StatusCode)
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Role returns the highest role mapped to any of the groups by the mapping, e.g. ["pingr-admins=admin", "sre=editor"],
+// or the default role if none is
+func Role(groups []string, mapping []string, defaultRole string) string {
+	role := defaultRole
+	for _, m := range mapping {
+		parts := strings.SplitN(strings.TrimSpace(m), "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		for _, g := range groups {
+			if g == parts[0] && pingr.RoleRank(parts[1]) > pingr.RoleRank(role) {
+				role = parts[1]
+			}
+		}
+	}
+	return role
+}
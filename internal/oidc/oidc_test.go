@@ -0,0 +1,194 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"pingr"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockIdP is an identity provider issuing codes for the claims of the next login
+type mockIdP struct {
+	*httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+	codes  map[string]url.Values // Query of the authorization request by code
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockIdP{key: key, codes: map[string]url.Values{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.URL,
+			"authorization_endpoint": m.URL + "/authorize",
+			"token_endpoint":         m.URL + "/token",
+			"jwks_uri":               m.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		_ = r.ParseForm()
+		auth, ok := m.codes[r.PostForm.Get("code")]
+		challenge := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		if !ok || auth.Get("code_challenge") != base64.RawURLEncoding.EncodeToString(challenge[:]) {
+			w.WriteHeader(400)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		claims := map[string]interface{}{
+			"iss":   m.URL,
+			"aud":   auth.Get("client_id"),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": auth.Get("nonce"),
+		}
+		for k, v := range m.claims {
+			claims[k] = v
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(t, claims)})
+	})
+	m.Server = httptest.NewServer(mux)
+	return m
+}
+
+// authorize signs in at the authorization URL, returning the code
+func (m *mockIdP) authorize(t *testing.T, authURL string) string {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := "code-" + u.Query().Get("state")
+	m.codes[code] = u.Query()
+	return code
+}
+
+func (m *mockIdP) sign(t *testing.T, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "k1"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func TestExchange(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.Close()
+	idp.claims = map[string]interface{}{"sub": "u1", "preferred_username": "alice", "groups": []string{"sre", "dev"}}
+
+	ctx := context.Background()
+	p := New(idp.URL, "pingr", "", "http://pingr/api/oidc/callback", []string{"openid"})
+	login, err := NewLogin("/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	authURL, err := p.AuthURL(ctx, login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := idp.authorize(t, authURL)
+
+	claims, err := p.Exchange(ctx, code, login)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Username() != "alice" || strings.Join(claims.Strings("groups"), ",") != "sre,dev" {
+		t.Logf("unexpected claims %v", claims)
+		t.Fail()
+	}
+
+	// Without the code verifier of the login
+	other, _ := NewLogin("/")
+	if _, err := p.Exchange(ctx, code, Login{Nonce: login.Nonce, Verifier: other.Verifier}); err == nil {
+		t.Log("expected an exchange with another code verifier to fail")
+		t.Fail()
+	}
+}
+
+func TestVerify(t *testing.T) {
+	idp := newMockIdP(t)
+	defer idp.Close()
+	p := New(idp.URL, "pingr", "", "http://pingr/api/oidc/callback", []string{"openid"})
+
+	valid := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   idp.URL,
+			"aud":   []string{"pingr", "other"},
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "n",
+			"sub":   "u1",
+		}
+	}
+	if _, err := p.Verify(context.Background(), idp.sign(t, valid()), "n"); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, change := range map[string]func(map[string]interface{}){
+		"issuer":   func(c map[string]interface{}) { c["iss"] = "https://evil" },
+		"audience": func(c map[string]interface{}) { c["aud"] = "other" },
+		"expired":  func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"nonce":    func(c map[string]interface{}) { c["nonce"] = "other" },
+	} {
+		claims := valid()
+		change(claims)
+		if _, err := p.Verify(context.Background(), idp.sign(t, claims), "n"); err == nil {
+			t.Logf("expected a token with another %s to be invalid", name)
+			t.Fail()
+		}
+	}
+
+	token := idp.sign(t, valid())
+	tampered := token[:strings.LastIndex(token, ".")-2] + "xx" + token[strings.LastIndex(token, "."):]
+	if _, err := p.Verify(context.Background(), tampered, "n"); err == nil {
+		t.Log("expected a tampered token to be invalid")
+		t.Fail()
+	}
+}
+
+func TestRole(t *testing.T) {
+	mapping := []string{"pingr-admins=admin", "sre=editor", "dev=viewer"}
+	cases := []struct {
+		groups      []string
+		defaultRole string
+		exp         string
+	}{
+		{[]string{"dev", "sre"}, "", pingr.RoleEditor},
+		{[]string{"pingr-admins", "dev"}, "", pingr.RoleAdmin},
+		{[]string{"sales"}, "", ""},
+		{[]string{"sales"}, pingr.RoleViewer, pingr.RoleViewer},
+		{nil, pingr.RoleViewer, pingr.RoleViewer},
+	}
+	for _, c := range cases {
+		if role := Role(c.groups, mapping, c.defaultRole); role != c.exp {
+			t.Logf("expected %v to be %q, got %q", c.groups, c.exp, role)
+			t.Fail()
+		}
+	}
+}
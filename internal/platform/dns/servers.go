@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"net/http"
+	"pingr/internal/config"
 	"sync"
 	"time"
 )
@@ -24,6 +25,9 @@ var (
 	}
 	dnsServerIpAddr   []string
 	defaultDNSServers = []string{"8.8.8.8", "1.1.1.1"}
+
+	// The lists are fetched once, a stalled request must not hold up every test waiting for it
+	client = &http.Client{Timeout: 10 * time.Second}
 )
 
 type publicDNSJSON struct {
@@ -36,12 +40,14 @@ func Get() []string {
 	once.Do(func() {
 		oneMonthAgo := time.Now().AddDate(0, -1, 0)
 		for _, country := range _DNSServerEndpoints {
-			resp, err := http.Get(fmt.Sprintf("https://public-dns.info/nameserver/%s.json", country))
+			resp, err := client.Get(fmt.Sprintf("https://public-dns.info/nameserver/%s.json", country))
 			if err != nil {
 				logrus.Error(fmt.Sprintf("Error fetching DNS server from %s: %s", country, err.Error()))
+				continue
 			}
 			var dns []publicDNSJSON
 			err = json.NewDecoder(resp.Body).Decode(&dns)
+			resp.Body.Close()
 			if err != nil {
 				logrus.Error(fmt.Sprintf("Unable to parse DNSJSON from %s: %s", country, err.Error()))
 			}
@@ -58,3 +64,8 @@ func Get() []string {
 	}
 	return defaultDNSServers
 }
+
+// Alternates are the resolvers failed tests are retried through with retry alternate set
+func Alternates() []string {
+	return config.Get().AlternateResolvers
+}
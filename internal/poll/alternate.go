@@ -0,0 +1,37 @@
+package poll
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Alternate resolves hostname through one of the resolvers and returns one of the resolved ip addresses,
+// both picked by attempt. It is used to retry a failing test from a different resolver/ip than the system default
+func Alternate(ctx context.Context, resolvers []string, hostname string, attempt int) (string, error) {
+	if net.ParseIP(hostname) != nil {
+		return hostname, nil
+	}
+	if len(resolvers) == 0 {
+		return "", errors.New("no resolvers to pick an alternate address from")
+	}
+
+	resolver := resolvers[attempt%len(resolvers)]
+	r := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", fmt.Sprintf("%s:%s", resolver, _port))
+		},
+	}
+
+	ips, err := r.LookupHost(ctx, hostname)
+	if err != nil {
+		return "", fmt.Errorf("could not resolve %s through %s: %v", hostname, resolver, err)
+	}
+	if len(ips) == 0 {
+		return "", fmt.Errorf("could not resolve %s through %s", hostname, resolver)
+	}
+	return ips[attempt%len(ips)], nil
+}
@@ -0,0 +1,30 @@
+package poll
+
+import (
+	"context"
+	"net"
+)
+
+// closeOnDone closes the connection once the context is done, aborting any blocking read or write.
+// The returned function stops it from doing so
+func closeOnDone(ctx context.Context, conn net.Conn) func() {
+	stop := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-stop:
+		}
+	}()
+	return func() {
+		close(stop)
+	}
+}
+
+// contextErr returns the error of the context if it is done, as the cause of err, otherwise err
+func contextErr(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
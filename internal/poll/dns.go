@@ -62,7 +62,7 @@ const (
 	Exact Strategy = "exact"
 )
 
-func DNS(resolvers []string, domain string, timeout time.Duration, record Record, strategy Strategy, check []string) (time.Duration, error) {
+func DNS(ctx context.Context, resolvers []string, domain string, record Record, strategy Strategy, check []string) (time.Duration, error) {
 	start := time.Now()
 
 Loop:
@@ -70,9 +70,7 @@ Loop:
 		r := &net.Resolver{
 			PreferGo: true,
 			Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
-				d := net.Dialer{
-					Timeout: timeout,
-				}
+				var d net.Dialer
 				return d.DialContext(ctx, "udp", fmt.Sprintf("%s:%s", addr, _port))
 			},
 		}
@@ -81,23 +79,23 @@ Loop:
 		var err error
 		switch record {
 		case A:
-			res, err = r.LookupHost(context.Background(), domain)
+			res, err = r.LookupHost(ctx, domain)
 			if err != nil {
 				return time.Since(start), err
 			}
 		case CNAME:
-			name, err := r.LookupCNAME(context.Background(), domain)
+			name, err := r.LookupCNAME(ctx, domain)
 			if err != nil {
 				return time.Since(start), err
 			}
 			res = []string{name}
 		case TXT:
-			res, err = r.LookupTXT(context.Background(), domain)
+			res, err = r.LookupTXT(ctx, domain)
 			if err != nil {
 				return time.Since(start), err
 			}
 		case MX:
-			mx, err := r.LookupMX(context.Background(), domain)
+			mx, err := r.LookupMX(ctx, domain)
 			if err != nil {
 				return time.Since(start), err
 			}
@@ -105,7 +103,7 @@ Loop:
 				res = append(res, x.Host)
 			}
 		case NS:
-			ns, err := r.LookupNS(context.Background(), domain)
+			ns, err := r.LookupNS(ctx, domain)
 			if err != nil {
 				return time.Since(start), err
 			}
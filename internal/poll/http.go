@@ -2,17 +2,32 @@ package poll
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"time"
 )
 
-func HTTP(hostname string, method string, to time.Duration, reqHeaders map[string]string, reqBody string, resStatus int, resHeaders map[string]string, resBody string) (time.Duration, error) {
-	client := http.Client{Timeout: to}
+// HTTP polls the url, if dialIP is set the request is sent to that ip instead of the one resolved for the url
+func HTTP(ctx context.Context, hostname string, method string, reqHeaders map[string]string, reqBody string, resStatus int, resHeaders map[string]string, resBody string, dialIP string) (time.Duration, error) {
+	var client http.Client
+	if dialIP != "" {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			_, port, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			var d net.Dialer
+			return d.DialContext(ctx, network, net.JoinHostPort(dialIP, port))
+		}
+		client.Transport = transport
+	}
 	start := time.Now()
 
-	req, err := http.NewRequest(method, hostname, bytes.NewBuffer([]byte(reqBody)))
+	req, err := http.NewRequestWithContext(ctx, method, hostname, bytes.NewBuffer([]byte(reqBody)))
 	if err != nil {
 		return time.Since(start), err
 	}
@@ -1,27 +1,70 @@
 package poll
 
 import (
+	"context"
+	"errors"
 	"github.com/tatsushid/go-fastping"
 	"net"
 	"time"
 )
 
-func Ping(hostname string, timeOut time.Duration) (responseTime time.Duration, err error) {
+// Ping sends a single echo request and waits for the reply until the deadline of the context
+func Ping(ctx context.Context, hostname string) (time.Duration, error) {
+	start := time.Now()
 	p := fastping.NewPinger()
 
-	ra, err := net.ResolveIPAddr("ip4", hostname)
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, hostname)
 	if err != nil {
-		return
+		return time.Since(start), err
+	}
+	var ra *net.IPAddr
+	for i := range addrs {
+		if addrs[i].IP.To4() != nil {
+			ra = &addrs[i]
+			break
+		}
+	}
+	if ra == nil {
+		return time.Since(start), errors.New("no ipv4 address found for " + hostname)
 	}
 
 	_, _ = p.Network("udp")
 	p.AddIPAddr(ra)
 
-	p.MaxRTT = timeOut
+	deadline, ok := ctx.Deadline()
+	if ok {
+		p.MaxRTT = time.Until(deadline)
+	}
 
-	start := time.Now()
-	err = p.Run()
-	responseTime = time.Since(start)
+	recv := make(chan time.Duration, 1)
+	p.OnRecv = func(_ *net.IPAddr, rtt time.Duration) {
+		select {
+		case recv <- rtt:
+		default:
+		}
+	}
+	idle := make(chan struct{}, 1)
+	p.OnIdle = func() {
+		select {
+		case idle <- struct{}{}:
+		default:
+		}
+	}
 
-	return
+	p.RunLoop()
+	defer p.Stop()
+
+	select {
+	case rtt := <-recv:
+		return rtt, nil
+	case <-idle:
+		return time.Since(start), errors.New("no echo reply received from " + hostname)
+	case <-p.Done():
+		if err := p.Err(); err != nil {
+			return time.Since(start), err
+		}
+		return time.Since(start), errors.New("no echo reply received from " + hostname)
+	case <-ctx.Done():
+		return time.Since(start), ctx.Err()
+	}
 }
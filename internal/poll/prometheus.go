@@ -1,6 +1,7 @@
 package poll
 
 import (
+	"context"
 	"io/ioutil"
 	"net/http"
 	"pingr/internal/push"
@@ -13,14 +14,12 @@ var (
 	mu             sync.RWMutex
 )
 
-func Prometheus(testId string, url string, timeout time.Duration, metricTests []push.MetricTest) (time.Duration, error) {
+func Prometheus(ctx context.Context, testId string, url string, metricTests []push.MetricTest) (time.Duration, error) {
 	start := time.Now()
 
-	client := http.Client{
-		Timeout: timeout,
-	}
+	var client http.Client
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return 0, err
 	}
@@ -1,14 +1,15 @@
 package poll
 
 import (
+	"context"
 	"errors"
-	"fmt"
 	"golang.org/x/crypto/ssh"
+	"net"
 	"pingr/internal/sec"
 	"time"
 )
 
-func SSH(hostname string, port string, timeOut time.Duration, username string, credentialType string, credential string) (time.Duration, error) {
+func SSH(ctx context.Context, hostname string, port string, username string, credentialType string, credential string) (time.Duration, error) {
 	var authMethod ssh.AuthMethod
 
 	protected := sec.Protected{
@@ -29,7 +30,7 @@ func SSH(hostname string, port string, timeOut time.Duration, username string, c
 	case "userpass":
 		authMethod = ssh.Password(protected.Plain)
 	default:
-		return 0, fmt.Errorf("invalid ssh credential type %s", credentialType)
+		return 0, errors.New("invalid ssh credential type " + credentialType)
 	}
 
 	err = protected.Seal()
@@ -42,22 +43,30 @@ func SSH(hostname string, port string, timeOut time.Duration, username string, c
 		Auth: []ssh.AuthMethod{
 			authMethod,
 		},
-		Timeout:         timeOut * time.Second,
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // TODO: Add public key check
 	}
 
 	start := time.Now()
-	client, err := ssh.Dial("tcp",
-		fmt.Sprintf("%s:%s", hostname, port),
-		config)
+	addr := net.JoinHostPort(hostname, port)
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
 	if err != nil {
 		return time.Since(start), err
 	}
+	defer conn.Close()
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if err != nil {
+		return time.Since(start), contextErr(ctx, err)
+	}
+	client := ssh.NewClient(c, chans, reqs)
 	defer client.Close()
 
 	session, err := client.NewSession()
 	if err != nil {
-		return time.Since(start), err
+		return time.Since(start), contextErr(ctx, err)
 	}
 	defer session.Close()
 
@@ -1,21 +1,16 @@
 package poll
 
 import (
-	"fmt"
+	"context"
 	"net"
 	"time"
 )
 
-func TCP(hostname string, port string, timeOut time.Duration) (time.Duration, error) {
+func TCP(ctx context.Context, hostname string, port string) (time.Duration, error) {
 	start := time.Now()
 
-	tcpAddr, err := net.ResolveTCPAddr("tcp", fmt.Sprintf("%s:%s", hostname, port))
-	if err != nil {
-		return time.Since(start), err
-	}
-
-	dialer := net.Dialer{Timeout: timeOut * time.Second}
-	conn, err := dialer.Dial("tcp", tcpAddr.String())
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(hostname, port))
 	if err != nil {
 		return time.Since(start), err
 	}
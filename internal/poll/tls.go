@@ -2,6 +2,7 @@ package poll
 
 import (
 	"bytes"
+	"context"
 	"crypto"
 	"crypto/tls"
 	"crypto/x509"
@@ -14,17 +15,19 @@ import (
 	"time"
 )
 
-func TLS(hostname string, port string, allowUnauthorizedOCSP bool, timeOut time.Duration) (time.Duration, error) {
+func TLS(ctx context.Context, hostname string, port string, allowUnauthorizedOCSP bool) (time.Duration, error) {
 
 	now := time.Now()
 	then := now.AddDate(0, 1, 0)
 
-	dialer := net.Dialer{Timeout: timeOut * time.Second}
-	netconn, err := dialer.Dial("tcp", fmt.Sprintf("%s:%s", hostname, port))
+	var dialer net.Dialer
+	netconn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(hostname, port))
 	if err != nil {
 		return time.Since(now), err
 	}
 	defer netconn.Close()
+	stop := closeOnDone(ctx, netconn)
+	defer stop()
 
 	conf := &tls.Config{ServerName: hostname}
 	cli := tls.Client(netconn, conf)
@@ -32,7 +35,7 @@ func TLS(hostname string, port string, allowUnauthorizedOCSP bool, timeOut time.
 
 	err = cli.Handshake()
 	if err != nil {
-		return time.Since(now), err
+		return time.Since(now), contextErr(ctx, err)
 	}
 
 	err = cli.VerifyHostname(hostname)
@@ -81,7 +84,7 @@ func TLS(hostname string, port string, allowUnauthorizedOCSP bool, timeOut time.
 				return time.Since(now), err
 			}
 			var res *ocsp.Response
-			res, err = GetOCSP(cert, issuer)
+			res, err = GetOCSP(ctx, cert, issuer)
 			if err != nil && err.Error() == unauthorized.Error() && allowUnauthorizedOCSP {
 				continue
 			}
@@ -98,7 +101,7 @@ func TLS(hostname string, port string, allowUnauthorizedOCSP bool, timeOut time.
 	return time.Since(now), nil
 }
 
-func GetOCSP(clientCert, issuerCert *x509.Certificate) (res *ocsp.Response, err error) {
+func GetOCSP(ctx context.Context, clientCert, issuerCert *x509.Certificate) (res *ocsp.Response, err error) {
 	servers := issuerCert.OCSPServer
 	if len(servers) < 1 {
 		return nil, fmt.Errorf("could not find any ocsp servers")
@@ -110,7 +113,7 @@ func GetOCSP(clientCert, issuerCert *x509.Certificate) (res *ocsp.Response, err
 	if err != nil {
 		return nil, err
 	}
-	httpRequest, err := http.NewRequest(http.MethodPost, ocspServer, bytes.NewBuffer(buffer))
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, ocspServer, bytes.NewBuffer(buffer))
 	if err != nil {
 		return
 	}
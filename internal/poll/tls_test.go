@@ -1,11 +1,15 @@
 package poll
 
 import (
+	"context"
 	"testing"
+	"time"
 )
 
 func TestTLS(t *testing.T) {
-	_, err := TLS("golang.org", "https", 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := TLS(ctx, "golang.org", "https", false)
 	if err != nil {
 		t.Log(err)
 		t.Fail()
@@ -106,7 +110,9 @@ var badTLS = []struct {
 
 func TestBadTLS(t *testing.T) {
 	for _, test := range badTLS {
-		_, err := TLS(test.host, test.port, 1)
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		_, err := TLS(ctx, test.host, test.port, false)
+		cancel()
 		if err == nil {
 			t.Log("Expected error for", test)
 			t.Fail()
@@ -0,0 +1,45 @@
+package push
+
+import (
+	"encoding/json"
+)
+
+type Signal string
+
+const (
+	Start  Signal = "start"
+	Finish Signal = "finish"
+	Fail   Signal = "fail"
+)
+
+func (s Signal) Validate() bool {
+	switch s {
+	case Start, Finish, Fail:
+		return true
+	}
+	return false
+}
+
+// Heartbeat is published to a push test when a job reports that it has started, finished or failed
+type Heartbeat struct {
+	Signal  Signal `json:"signal"`
+	Message string `json:"message,omitempty"`
+}
+
+func (h Heartbeat) Encode() ([]byte, error) {
+	return json.Marshal(h)
+}
+
+// DecodeHeartbeat returns an empty heartbeat if the pushed data is not a signal, i.e. a plain push. Only the signal
+// endpoints publish data to HTTPPush tests, the bodies of plain pushes are left out so they can't pass for signals
+func DecodeHeartbeat(data []byte) Heartbeat {
+	var h Heartbeat
+	if len(data) == 0 {
+		return h
+	}
+	err := json.Unmarshal(data, &h)
+	if err != nil || !h.Signal.Validate() {
+		return Heartbeat{}
+	}
+	return h
+}
@@ -0,0 +1,338 @@
+package push
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const excerptSize = 256
+
+type JSONOperator string
+
+const (
+	Equal          JSONOperator = "=="
+	NotEqual       JSONOperator = "!="
+	Less           JSONOperator = "<"
+	LessOrEqual    JSONOperator = "<="
+	Greater        JSONOperator = ">"
+	GreaterOrEqual JSONOperator = ">="
+	Exists         JSONOperator = "exists"
+	NotExists      JSONOperator = "not_exists"
+)
+
+// JSONAssertion compares the value found at Path, e.g. $.result.errors[0].code, with Value
+type JSONAssertion struct {
+	Path     string          `json:"path"`
+	Operator JSONOperator    `json:"operator"`
+	Value    json.RawMessage `json:"value"`
+}
+
+func (a JSONAssertion) Validate() bool {
+	if _, err := parsePath(a.Path); err != nil {
+		return false
+	}
+	switch a.Operator {
+	case Exists, NotExists:
+		return true
+	case Equal, NotEqual, Less, LessOrEqual, Greater, GreaterOrEqual:
+	default:
+		return false
+	}
+	if len(a.Value) == 0 {
+		return false
+	}
+	_, err := decode(a.Value)
+	return err == nil
+}
+
+// JSONStatus maps the value found at Path to success or error, e.g. "status": "finished" / "failed"
+type JSONStatus struct {
+	Path    string   `json:"path"`
+	Success []string `json:"success"`
+	Error   []string `json:"error"`
+}
+
+func (s JSONStatus) Validate() bool {
+	if s.Path == "" {
+		return len(s.Success) == 0 && len(s.Error) == 0
+	}
+	if _, err := parsePath(s.Path); err != nil {
+		return false
+	}
+	if len(s.Success) == 0 && len(s.Error) == 0 {
+		return false
+	}
+	return true
+}
+
+func JSON(body []byte, required []string, status JSONStatus, assertions []JSONAssertion) error {
+	doc, err := decode(body)
+	if err != nil {
+		return fmt.Errorf("could not parse pushed body as json: %v", err)
+	}
+
+	for _, path := range required {
+		_, ok, err := lookup(doc, path)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("required field %s is missing", path)
+		}
+	}
+
+	if status.Path != "" {
+		value, ok, err := lookup(doc, status.Path)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("status field %s is missing", status.Path)
+		}
+		s := stringify(value)
+		if contains(status.Error, s) {
+			return fmt.Errorf("status field %s reported %s", status.Path, s)
+		}
+		if len(status.Success) > 0 && !contains(status.Success, s) {
+			return fmt.Errorf("status field %s reported %s, expected one of: %s", status.Path, s, strings.Join(status.Success, ", "))
+		}
+	}
+
+	for _, assertion := range assertions {
+		err = assertion.evaluate(doc)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ValidPath(path string) bool {
+	_, err := parsePath(path)
+	return err == nil
+}
+
+// Excerpt returns the start of a pushed body, suitable for storing in a log message
+func Excerpt(body []byte) string {
+	if len(body) <= excerptSize {
+		return string(body)
+	}
+	return string(body[:excerptSize]) + "..."
+}
+
+func (a JSONAssertion) evaluate(doc interface{}) error {
+	value, ok, err := lookup(doc, a.Path)
+	if err != nil {
+		return err
+	}
+
+	switch a.Operator {
+	case Exists:
+		if !ok {
+			return fmt.Errorf("expected %s to exist", a.Path)
+		}
+		return nil
+	case NotExists:
+		if ok {
+			return fmt.Errorf("expected %s to not exist, got: %s", a.Path, stringify(value))
+		}
+		return nil
+	}
+	if !ok {
+		return fmt.Errorf("%s is missing", a.Path)
+	}
+
+	expected, err := decode(a.Value)
+	if err != nil {
+		return fmt.Errorf("invalid assertion value for %s: %v", a.Path, err)
+	}
+
+	var holds bool
+	switch a.Operator {
+	case Equal:
+		holds = equal(value, expected)
+	case NotEqual:
+		holds = !equal(value, expected)
+	default:
+		cmp, err := compare(value, expected)
+		if err != nil {
+			return fmt.Errorf("could not compare %s: %v", a.Path, err)
+		}
+		switch a.Operator {
+		case Less:
+			holds = cmp < 0
+		case LessOrEqual:
+			holds = cmp <= 0
+		case Greater:
+			holds = cmp > 0
+		case GreaterOrEqual:
+			holds = cmp >= 0
+		default:
+			return fmt.Errorf("invalid operator: %s", a.Operator)
+		}
+	}
+
+	if !holds {
+		return fmt.Errorf("expected %s %s %s, got: %s", a.Path, a.Operator, stringify(expected), stringify(value))
+	}
+	return nil
+}
+
+func decode(data []byte) (interface{}, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	err := d.Decode(&v)
+	return v, err
+}
+
+func equal(a, b interface{}) bool {
+	an, aok := a.(json.Number)
+	bn, bok := b.(json.Number)
+	if aok && bok {
+		af, aerr := an.Float64()
+		bf, berr := bn.Float64()
+		if aerr == nil && berr == nil {
+			return af == bf
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(a, b interface{}) (int, error) {
+	switch av := a.(type) {
+	case json.Number:
+		bv, ok := b.(json.Number)
+		if !ok {
+			return 0, errors.New("value is a number")
+		}
+		af, err := av.Float64()
+		if err != nil {
+			return 0, err
+		}
+		bf, err := bv.Float64()
+		if err != nil {
+			return 0, err
+		}
+		switch {
+		case af < bf:
+			return -1, nil
+		case af > bf:
+			return 1, nil
+		}
+		return 0, nil
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, errors.New("value is a string")
+		}
+		return strings.Compare(av, bv), nil
+	}
+	return 0, errors.New("only numbers and strings can be ordered")
+}
+
+func stringify(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case nil:
+		return "null"
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+type pathElement struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// parsePath parses a subset of JSONPath: $, .key, ['key'] and [index]
+func parsePath(path string) ([]pathElement, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, fmt.Errorf("invalid path %s: has to start with $", path)
+	}
+
+	var elements []pathElement
+	for i := 1; i < len(path); {
+		switch path[i] {
+		case '.':
+			j := i + 1
+			for j < len(path) && path[j] != '.' && path[j] != '[' {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("invalid path %s: empty key at %d", path, i)
+			}
+			elements = append(elements, pathElement{key: path[i+1 : j]})
+			i = j
+		case '[':
+			end := strings.IndexByte(path[i:], ']')
+			if end == -1 {
+				return nil, fmt.Errorf("invalid path %s: missing ]", path)
+			}
+			inner := path[i+1 : i+end]
+			if len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0] {
+				elements = append(elements, pathElement{key: inner[1 : len(inner)-1]})
+			} else {
+				index, err := strconv.Atoi(inner)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("invalid path %s: bad index %s", path, inner)
+				}
+				elements = append(elements, pathElement{index: index, isIndex: true})
+			}
+			i += end + 1
+		default:
+			return nil, fmt.Errorf("invalid path %s: unexpected %c at %d", path, path[i], i)
+		}
+	}
+	return elements, nil
+}
+
+func lookup(doc interface{}, path string) (interface{}, bool, error) {
+	elements, err := parsePath(path)
+	if err != nil {
+		return nil, false, err
+	}
+
+	current := doc
+	for _, e := range elements {
+		if e.isIndex {
+			list, ok := current.([]interface{})
+			if !ok || e.index >= len(list) {
+				return nil, false, nil
+			}
+			current = list[e.index]
+			continue
+		}
+		obj, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false, nil
+		}
+		current, ok = obj[e.key]
+		if !ok {
+			return nil, false, nil
+		}
+	}
+	return current, true, nil
+}
@@ -0,0 +1,69 @@
+package push
+
+import (
+	"testing"
+)
+
+const jsonBody = `{
+	"job": "nightly-import",
+	"status": "finished",
+	"result": {"errors": 3, "imported": 1200, "tags": ["a", "b"]}
+}`
+
+var jsonAssertions = []struct {
+	assertion JSONAssertion
+	ok        bool
+}{
+	{JSONAssertion{Path: "$.result.errors", Operator: LessOrEqual, Value: []byte("5")}, true},
+	{JSONAssertion{Path: "$.result.errors", Operator: Equal, Value: []byte("0")}, false},
+	{JSONAssertion{Path: "$.result.imported", Operator: Greater, Value: []byte("1000")}, true},
+	{JSONAssertion{Path: "$['job']", Operator: Equal, Value: []byte(`"nightly-import"`)}, true},
+	{JSONAssertion{Path: "$.result.tags[1]", Operator: NotEqual, Value: []byte(`"a"`)}, true},
+	{JSONAssertion{Path: "$.result.tags[2]", Operator: Exists}, false},
+	{JSONAssertion{Path: "$.result.warnings", Operator: NotExists}, true},
+	{JSONAssertion{Path: "$.job", Operator: Less, Value: []byte("3")}, false},
+}
+
+func TestJSONAssertions(t *testing.T) {
+	for _, test := range jsonAssertions {
+		if !test.assertion.Validate() {
+			t.Logf("assertion on %s should be valid", test.assertion.Path)
+			t.Fail()
+			continue
+		}
+		err := JSON([]byte(jsonBody), nil, JSONStatus{}, []JSONAssertion{test.assertion})
+		if (err == nil) != test.ok {
+			t.Logf("%s %s %s: expected ok=%v, got: %v", test.assertion.Path, test.assertion.Operator, test.assertion.Value, test.ok, err)
+			t.Fail()
+		}
+	}
+}
+
+func TestJSONStatus(t *testing.T) {
+	err := JSON([]byte(jsonBody), []string{"$.job", "$.result.imported"}, JSONStatus{Path: "$.status", Success: []string{"finished"}}, nil)
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	err = JSON([]byte(jsonBody), nil, JSONStatus{Path: "$.status", Error: []string{"finished"}}, nil)
+	if err == nil {
+		t.Log("expected status mapped to error to fail")
+		t.Fail()
+	}
+
+	err = JSON([]byte(jsonBody), []string{"$.result.duration"}, JSONStatus{}, nil)
+	if err == nil {
+		t.Log("expected missing required field to fail")
+		t.Fail()
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	for _, path := range []string{"", "result", "$.", "$[x]", "$.a[0", "$..a"} {
+		if _, err := parsePath(path); err == nil {
+			t.Logf("expected %q to be an invalid path", path)
+			t.Fail()
+		}
+	}
+}
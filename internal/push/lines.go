@@ -0,0 +1,141 @@
+package push
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Line is a single metric received over the StatsD or Graphite line protocols
+type Line struct {
+	Name   string            `json:"name"`
+	Value  float64           `json:"value"`
+	Type   string            `json:"type"` // StatsD type, c, g, ms, h, d or s. Empty for Graphite
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// ParseStatsD parses "<name>:<value>|<type>[|@<sample rate>][|#<tag>:<value>,...]"
+func ParseStatsD(raw string) (Line, error) {
+	var l Line
+	raw = strings.TrimSpace(raw)
+
+	colon := strings.LastIndex(strings.SplitN(raw, "|", 2)[0], ":")
+	if colon < 1 {
+		return l, fmt.Errorf("invalid statsd line: %s", raw)
+	}
+	l.Name = raw[:colon]
+
+	parts := strings.Split(raw[colon+1:], "|")
+	if len(parts) < 2 {
+		return l, fmt.Errorf("invalid statsd line, missing type: %s", raw)
+	}
+	value, err := strconv.ParseFloat(parts[0], 64)
+	if err != nil {
+		return l, fmt.Errorf("invalid statsd value: %s", raw)
+	}
+	l.Value = value
+
+	switch parts[1] {
+	case "c", "g", "ms", "h", "d", "s":
+		l.Type = parts[1]
+	default:
+		return l, fmt.Errorf("invalid statsd type: %s", raw)
+	}
+
+	for _, part := range parts[2:] {
+		switch {
+		case strings.HasPrefix(part, "@"):
+			rate, err := strconv.ParseFloat(part[1:], 64)
+			if err != nil || rate <= 0 || rate > 1 {
+				return l, fmt.Errorf("invalid statsd sample rate: %s", raw)
+			}
+			if l.Type == "c" {
+				l.Value = l.Value / rate
+			}
+		case strings.HasPrefix(part, "#"):
+			l.Labels = map[string]string{}
+			for _, tag := range strings.Split(part[1:], ",") {
+				kv := strings.SplitN(tag, ":", 2)
+				if len(kv) == 2 {
+					l.Labels[kv[0]] = kv[1]
+				} else {
+					l.Labels[kv[0]] = ""
+				}
+			}
+		}
+	}
+	return l, nil
+}
+
+// ParseGraphite parses "<name>[;<tag>=<value>...] <value> [<timestamp>]"
+func ParseGraphite(raw string) (Line, error) {
+	var l Line
+
+	fields := strings.Fields(raw)
+	if len(fields) < 2 || len(fields) > 3 {
+		return l, fmt.Errorf("invalid graphite line: %s", raw)
+	}
+
+	value, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return l, fmt.Errorf("invalid graphite value: %s", raw)
+	}
+	l.Value = value
+
+	tags := strings.Split(fields[0], ";")
+	l.Name = tags[0]
+	if len(tags) > 1 {
+		l.Labels = map[string]string{}
+		for _, tag := range tags[1:] {
+			kv := strings.SplitN(tag, "=", 2)
+			if len(kv) != 2 {
+				return l, fmt.Errorf("invalid graphite tag: %s", raw)
+			}
+			l.Labels[kv[0]] = kv[1]
+		}
+	}
+	return l, nil
+}
+
+// Lines evaluates metric tests against a batch of lines. Metrics that are not part of the batch are not evaluated,
+// counters are summed up over the batch and gauges, timers and graphite values have to be within bounds.
+func Lines(body []byte, metricTests []MetricTest) error {
+	var lines []Line
+	err := json.Unmarshal(body, &lines)
+	if err != nil {
+		return fmt.Errorf("could not parse pushed lines: %v", err)
+	}
+
+	for _, metricTest := range metricTests {
+		var sum float64
+		var counter bool
+		for _, line := range lines {
+			if line.Name != metricTest.Key || !matchLabels(line.Labels, metricTest.Labels) {
+				continue
+			}
+			switch line.Type {
+			case "c":
+				counter = true
+				sum += line.Value
+			default:
+				if metricTest.LowerBound > line.Value || line.Value > metricTest.UpperBound {
+					return fmt.Errorf("expected key: %s to be between %.3f and %.3f got: %.3f", metricTest.Key, metricTest.LowerBound, metricTest.UpperBound, line.Value)
+				}
+			}
+		}
+		if counter && (sum < metricTest.LowerBound || sum > metricTest.UpperBound) {
+			return fmt.Errorf("expected key: %s COUNTER to increase between %.3f and %.3f got: %.3f", metricTest.Key, metricTest.LowerBound, metricTest.UpperBound, sum)
+		}
+	}
+	return nil
+}
+
+func matchLabels(labels map[string]string, expected map[string]string) bool {
+	for k, v := range expected {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
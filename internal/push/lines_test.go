@@ -0,0 +1,67 @@
+package push
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParseStatsD(t *testing.T) {
+	l, err := ParseStatsD("batch.import.rows:10|c|@0.5|#env:prod,team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Name != "batch.import.rows" || l.Value != 20 || l.Type != "c" || l.Labels["env"] != "prod" {
+		t.Logf("unexpected line: %+v", l)
+		t.Fail()
+	}
+
+	for _, raw := range []string{"", "name", "name:1", "name:x|c", "name:1|q", "name:1|c|@2"} {
+		if _, err := ParseStatsD(raw); err == nil {
+			t.Logf("expected %q to be invalid", raw)
+			t.Fail()
+		}
+	}
+}
+
+func TestParseGraphite(t *testing.T) {
+	l, err := ParseGraphite("batch.import.duration;env=prod 12.5 1594389600")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Name != "batch.import.duration" || l.Value != 12.5 || l.Labels["env"] != "prod" {
+		t.Logf("unexpected line: %+v", l)
+		t.Fail()
+	}
+
+	for _, raw := range []string{"", "name", "name x", "name;env 1", "name 1 2 3"} {
+		if _, err := ParseGraphite(raw); err == nil {
+			t.Logf("expected %q to be invalid", raw)
+			t.Fail()
+		}
+	}
+}
+
+func TestLines(t *testing.T) {
+	lines := []Line{
+		{Name: "import.rows", Value: 5, Type: "c"},
+		{Name: "import.rows", Value: 7, Type: "c"},
+		{Name: "import.duration", Value: 300, Type: "ms"},
+	}
+	body, _ := json.Marshal(lines)
+
+	err := Lines(body, []MetricTest{
+		{Key: "import.rows", LowerBound: 10, UpperBound: 20},
+		{Key: "import.duration", LowerBound: 0, UpperBound: 1000},
+		{Key: "import.missing", LowerBound: 0, UpperBound: 0},
+	})
+	if err != nil {
+		t.Log(err)
+		t.Fail()
+	}
+
+	err = Lines(body, []MetricTest{{Key: "import.duration", LowerBound: 0, UpperBound: 100}})
+	if err == nil {
+		t.Log("expected timer above upper bound to fail")
+		t.Fail()
+	}
+}
@@ -0,0 +1,245 @@
+package agents
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"pingr"
+	"pingr/internal/bus"
+	"pingr/internal/dao"
+	"pingr/internal/sec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Init adds the endpoints managing agents
+func Init(g *echo.Group) {
+	g.GET("", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		agents, err := dao.GetAgents(db)
+		if err != nil {
+			return c.String(500, "could not get agents: "+err.Error())
+		}
+		return c.JSON(200, agents)
+	})
+
+	g.GET("/:agentId", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		agent, err := dao.GetAgent(c.Param("agentId"), db)
+		if err != nil {
+			return c.String(400, "Not a valid agentId, "+err.Error())
+		}
+		return c.JSON(200, agent)
+	})
+
+	// Add an agent, its token is only returned once
+	g.POST("", func(c echo.Context) error {
+		var agent pingr.Agent
+		if err := c.Bind(&agent); err != nil {
+			return c.String(400, "Could not parse body as agent: "+err.Error())
+		}
+		agent.AgentId = uuid.New().String()
+		agent.CreatedAt = time.Now()
+		if !agent.Validate() {
+			return c.String(400, "invalid input: Agent")
+		}
+
+		token, err := sec.NewToken()
+		if err != nil {
+			return c.String(500, "could not generate token: "+err.Error())
+		}
+		agent.TokenHash = sec.HashToken(token)
+
+		db := c.Get("DB").(*sqlx.DB)
+		err = dao.PostAgent(agent, db)
+		if err != nil {
+			return c.String(500, "could not add agent to db: "+err.Error())
+		}
+		return c.JSON(200, map[string]interface{}{"agent": agent, "token": token})
+	})
+
+	// Rotate the token of an agent, the token is only returned once
+	g.POST("/:agentId/token", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		agentId := c.Param("agentId")
+
+		_, err := dao.GetAgent(agentId, db)
+		if err != nil {
+			return c.String(400, "Not a valid agentId, "+err.Error())
+		}
+
+		token, err := sec.NewToken()
+		if err != nil {
+			return c.String(500, "could not generate token: "+err.Error())
+		}
+		err = dao.PutAgentToken(agentId, sec.HashToken(token), db)
+		if err != nil {
+			return c.String(500, "could not save agent token: "+err.Error())
+		}
+		return c.JSON(200, map[string]string{"token": token})
+	})
+
+	g.DELETE("/:agentId", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		agentId := c.Param("agentId")
+
+		_, err := dao.GetAgent(agentId, db)
+		if err != nil {
+			return c.String(400, "Not a valid agentId, "+err.Error())
+		}
+
+		err = dao.DeleteAgent(agentId, db)
+		if err != nil {
+			return c.String(500, "could not delete agent: "+err.Error())
+		}
+		return c.String(200, "agent deleted")
+	})
+}
+
+// InitRemote adds the endpoints used by the agents themselves, authenticated by the agent's token
+func InitRemote(g *echo.Group, buz *bus.Bus) {
+	g.Use(agentAuth)
+
+	// Get the tests assigned to the agent's location
+	g.GET("/tests", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		agent := c.Get("Agent").(pingr.Agent)
+
+		tests, err := dao.GetLocationTests(agent.Location, db)
+		if err != nil {
+			return c.String(500, "could not get tests: "+err.Error())
+		}
+		remote := []pingr.GenericTest{}
+		for _, test := range tests {
+			if test.RemoteCapable() {
+				remote = append(remote, test)
+			}
+		}
+		return c.JSON(200, remote)
+	})
+
+	// Report results of tests run by the agent
+	g.POST("/results", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		agent := c.Get("Agent").(pingr.Agent)
+
+		var results []pingr.AgentResult
+		if err := c.Bind(&results); err != nil {
+			return c.String(400, "Could not parse body as results: "+err.Error())
+		}
+
+		tests, err := dao.GetLocationTests(agent.Location, db)
+		if err != nil {
+			return c.String(500, "could not get tests: "+err.Error())
+		}
+		assigned := map[string]pingr.GenericTest{}
+		for _, test := range tests {
+			assigned[test.TestId] = test
+		}
+
+		now := time.Now()
+		for _, r := range results {
+			test, ok := assigned[r.TestId]
+			if !ok {
+				continue // Unassigned while the agent was running it
+			}
+			if r.CreatedAt.IsZero() || r.CreatedAt.After(now) {
+				r.CreatedAt = now // Agents of earlier versions, or with a clock ahead
+			}
+			expires := r.CreatedAt.Add(test.StaleAfter())
+			if now.After(expires) {
+				continue // Kept by the agent while pingrd could not be reached, and no longer relevant
+			}
+			if r.ResultId != "" && !firstReceipt(r.ResultId, expires) {
+				continue // Sent again along with results that could not be received
+			}
+
+			r.Location = agent.Location
+			data, err := json.Marshal(r)
+			if err != nil {
+				forget(r.ResultId)
+				return c.String(500, "could not marshal result: "+err.Error())
+			}
+			err = publish(c, buz, data)
+			if err != nil {
+				forget(r.ResultId)
+				return c.String(503, "could not publish result: "+err.Error())
+			}
+		}
+		return c.String(200, "results received")
+	})
+}
+
+var (
+	muReceived sync.Mutex
+	received   = map[string]time.Time{} // Expiry by result id
+)
+
+// firstReceipt records the result as received until it expires, returning false if it already was
+func firstReceipt(resultId string, expires time.Time) bool {
+	muReceived.Lock()
+	defer muReceived.Unlock()
+
+	now := time.Now()
+	for id, e := range received {
+		if now.After(e) {
+			delete(received, id)
+		}
+	}
+
+	if _, ok := received[resultId]; ok {
+		return false
+	}
+	received[resultId] = expires
+	return true
+}
+
+// forget lets a result that could not be received be sent again
+func forget(resultId string) {
+	muReceived.Lock()
+	defer muReceived.Unlock()
+	delete(received, resultId)
+}
+
+// publish waits for the scheduler to take the result, as the bus only queues one message per topic
+func publish(c echo.Context, buz *bus.Bus, data []byte) error {
+	for {
+		err := buz.Publish("result", data)
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-c.Request().Context().Done():
+			return err
+		}
+	}
+}
+
+func agentAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+
+		token := strings.TrimPrefix(c.Request().Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			return c.String(401, "missing agent token")
+		}
+		agent, err := dao.GetAgentByTokenHash(sec.HashToken(token), db)
+		if err == sql.ErrNoRows {
+			return c.String(401, "invalid agent token")
+		}
+		if err != nil {
+			return c.String(500, "could not get agent: "+err.Error())
+		}
+
+		err = dao.SetAgentSeen(agent.AgentId, time.Now(), db)
+		if err != nil {
+			return c.String(500, "could not update agent: "+err.Error())
+		}
+		c.Set("Agent", agent)
+		return next(c)
+	}
+}
@@ -3,6 +3,7 @@ package health
 import (
 	"github.com/labstack/echo-contrib/prometheus"
 	"github.com/labstack/echo/v4"
+	"pingr/internal/ha"
 )
 
 func SetMetrics(e *echo.Echo) {
@@ -16,4 +17,12 @@ func Init(closing <-chan struct{}, g *echo.Group) {
 	g.GET("/ping", func(context echo.Context) error {
 		return context.String(200, "pong")
 	})
+
+	// For load balancers to route traffic to the leader in HA mode
+	g.GET("/leader", func(context echo.Context) error {
+		if !ha.IsLeader() {
+			return context.String(503, "follower")
+		}
+		return context.String(200, "leader")
+	})
 }
@@ -2,46 +2,53 @@ package resources
 
 import (
 	"context"
-	"crypto/subtle"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/crypto/acme/autocert"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"path"
+	"pingr"
+	"pingr/internal/auth"
 	"pingr/internal/bus"
 	"pingr/internal/config"
+	"pingr/internal/ha"
 	"pingr/internal/logging"
+	"pingr/internal/resources/agents"
 	"pingr/internal/resources/contacts"
 	"pingr/internal/resources/health"
 	"pingr/internal/resources/incidents"
 	"pingr/internal/resources/logs"
+	"pingr/internal/resources/maintenance"
 	"pingr/internal/resources/push"
+	"pingr/internal/resources/pushauth"
+	"pingr/internal/resources/sso"
 	"pingr/internal/resources/testcontacts"
 	"pingr/internal/resources/tests"
+	"pingr/internal/resources/transfer"
+	"pingr/internal/resources/users"
 	"pingr/ui"
 	"strings"
 )
 
 func Init(closing <-chan struct{}, db *sqlx.DB, buz *bus.Bus) {
 	cfg := config.Get()
-	basicAuth := middleware.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
-		validUser := false
-		validPass := false
-		if subtle.ConstantTimeCompare([]byte(username), []byte(cfg.BasicAuthUser)) == 1 {
-			validUser = true
-		}
-		if subtle.ConstantTimeCompare([]byte(password), []byte(cfg.BasicAuthPass)) == 1 {
-			validPass = true
-		}
-		return validUser && validPass, nil
-	})
+	// Reads, and writes, of each group require at least these roles
+	viewer := []echo.MiddlewareFunc{auth.Authenticate, auth.Allow(pingr.RoleViewer, pingr.RoleViewer)}
+	editor := []echo.MiddlewareFunc{auth.Authenticate, auth.Allow(pingr.RoleViewer, pingr.RoleEditor)}
+	admin := []echo.MiddlewareFunc{auth.Authenticate, auth.Allow(pingr.RoleAdmin, pingr.RoleAdmin)}
 
 	e := echo.New()
+	ipExtractor, err := clientIP(cfg.TrustedProxies)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	e.IPExtractor = ipExtractor
 	e.Use(logging.RequestIdMiddleware())
 	e.Use(logging.EchoMiddleware(nil))
 	e.Use(logging.GetDBMiddleware(db))
@@ -50,13 +57,23 @@ func Init(closing <-chan struct{}, db *sqlx.DB, buz *bus.Bus) {
 	health.SetMetrics(e)
 	health.Init(closing, e.Group("api/health"))
 
-	tests.Init(e.Group("api/tests", basicAuth), buz)
-	logs.Init(e.Group("api/logs", basicAuth))
-	contacts.Init(e.Group("api/contacts", basicAuth))
-	testcontacts.Init(e.Group("api/testcontacts", basicAuth))
-	incidents.Init(e.Group("api/incidents", basicAuth))
+	tests.Init(e.Group("api/tests", editor...), buz)
+	logs.Init(e.Group("api/logs", editor...))
+	contacts.Init(e.Group("api/contacts", editor...))
+	testcontacts.Init(e.Group("api/testcontacts", editor...))
+	incidents.Init(e.Group("api/incidents", editor...))
+	pushauth.Init(e.Group("api/pushauth", editor...))
+	maintenance.Init(e.Group("api/maintenance", editor...))
+	agents.Init(e.Group("api/agents", auth.Authenticate, auth.Allow(pingr.RoleViewer, pingr.RoleAdmin)))
+	// Exports may hold all credentials, so read-only tokens are not allowed to export
+	export := e.Group("api/export", auth.Authenticate, auth.AllowWrite(pingr.RoleAdmin))
+	transfer.Init(export, e.Group("api/import", admin...), buz)
+	users.Init(e.Group("api/users", auth.Authenticate), e.Group("api/tokens", auth.Authenticate))
+	sso.Init(e.Group("api/oidc"))
+
+	agents.InitRemote(e.Group("api/agent", ha.LeaderOnly), buz)
 
-	push.Init(e.Group("api/push"), buz)
+	push.Init(e.Group("api/push", ha.LeaderOnly), buz)
 
 	// UI
 	e.GET("/*", func(c echo.Context) error {
@@ -97,7 +114,7 @@ func Init(closing <-chan struct{}, db *sqlx.DB, buz *bus.Bus) {
 			contentType = http.DetectContentType(data)
 		}
 		return c.Blob(200, contentType, data)
-	}, basicAuth)
+	}, viewer...)
 
 	if cfg.AutoTLS {
 		go func() {
@@ -115,19 +132,53 @@ func Init(closing <-chan struct{}, db *sqlx.DB, buz *bus.Bus) {
 		if len(cfg.AutoTLSEmail) > 0 {
 			e.AutoTLSManager.Email = config.Get().AutoTLSEmail
 		}
-		go e.Logger.Fatal(e.StartAutoTLS(fmt.Sprintf(":%d", config.Get().PortHTTPS)))
+		go func() {
+			err := e.StartAutoTLS(fmt.Sprintf(":%d", config.Get().PortHTTPS))
+			if err != http.ErrServerClosed {
+				e.Logger.Fatal(err)
+			}
+		}()
 	} else {
-		go e.Logger.Fatal(e.Start(fmt.Sprintf(":%d", config.Get().PortHTTP)))
+		go func() {
+			err := e.Start(fmt.Sprintf(":%d", config.Get().PortHTTP))
+			if err != http.ErrServerClosed {
+				e.Logger.Fatal(err)
+			}
+		}()
 	}
 
 	<-closing
 	c, cancel := context.WithTimeout(context.Background(), config.Get().TermDuration)
 	defer cancel()
 	logrus.Info("Gracefully closing Echo")
-	err := e.Shutdown(c)
+	err = e.Shutdown(c)
 	if err != nil {
 		logrus.Warn("Could not gracefully close Echo, will force it")
 		_ = e.Close()
 	}
 	logrus.Info("Echo has been shutdown")
 }
+
+// clientIP takes the ip of the client from X-Forwarded-For of requests through the trusted proxies, and otherwise
+// from the connection
+func clientIP(proxies []string) (echo.IPExtractor, error) {
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if ip := net.ParseIP(proxy); ip != nil {
+			proxy = ip.String() + "/32"
+			if ip.To4() == nil {
+				proxy = ip.String() + "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES: %v", err)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
@@ -0,0 +1,120 @@
+package maintenance
+
+import (
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"pingr"
+	"pingr/internal/dao"
+	"time"
+)
+
+func Init(g *echo.Group) {
+	g.GET("", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		maintenances, err := dao.GetMaintenances(db)
+		if err != nil {
+			return c.String(500, "could not get maintenance: "+err.Error())
+		}
+		return c.JSON(200, maintenances)
+	})
+
+	g.GET("/active", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		maintenances, err := dao.GetMaintenances(db)
+		if err != nil {
+			return c.String(500, "could not get maintenance: "+err.Error())
+		}
+
+		now := time.Now()
+		active := []pingr.Maintenance{}
+		for _, m := range maintenances {
+			if m.Active(now) {
+				active = append(active, m)
+			}
+		}
+		return c.JSON(200, active)
+	})
+
+	g.GET("/:maintenanceId", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		maintenanceId := c.Param("maintenanceId")
+
+		m, err := dao.GetMaintenance(maintenanceId, db)
+		if err != nil {
+			return c.String(500, "could not get maintenance: "+err.Error())
+		}
+		return c.JSON(200, m)
+	})
+
+	g.POST("", func(c echo.Context) error {
+		var m pingr.Maintenance
+		if err := c.Bind(&m); err != nil {
+			return c.String(400, "Could not parse body as maintenance: "+err.Error())
+		}
+		m.MaintenanceId = uuid.New().String()
+		m.CreatedAt = time.Now()
+		if !m.Validate() {
+			return c.String(400, "invalid input: Maintenance")
+		}
+
+		db := c.Get("DB").(*sqlx.DB)
+		for _, testId := range m.TestIds {
+			_, err := dao.GetRawTest(testId, db)
+			if err != nil {
+				return c.String(400, "Not a valid testId, "+testId)
+			}
+		}
+
+		err := dao.PostMaintenance(m, db)
+		if err != nil {
+			return c.String(500, "could not add maintenance to db: "+err.Error())
+		}
+		return c.JSON(200, m)
+	})
+
+	g.PUT("", func(c echo.Context) error {
+		var m pingr.Maintenance
+		if err := c.Bind(&m); err != nil {
+			return c.String(400, "Could not parse body as maintenance: "+err.Error())
+		}
+		if !m.Validate() {
+			return c.String(400, "invalid input: Maintenance")
+		}
+
+		db := c.Get("DB").(*sqlx.DB)
+		old, err := dao.GetMaintenance(m.MaintenanceId, db)
+		if err != nil {
+			return c.String(400, "Not a valid maintenanceId, "+err.Error())
+		}
+		m.CreatedAt = old.CreatedAt
+		for _, testId := range m.TestIds {
+			_, err := dao.GetRawTest(testId, db)
+			if err != nil {
+				return c.String(400, "Not a valid testId, "+testId)
+			}
+		}
+
+		err = dao.PutMaintenance(m, db)
+		if err != nil {
+			return c.String(500, "could not update maintenance: "+err.Error())
+		}
+		return c.String(200, "maintenance updated")
+	})
+
+	g.DELETE("/:maintenanceId", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		maintenanceId := c.Param("maintenanceId")
+
+		_, err := dao.GetMaintenance(maintenanceId, db)
+		if err != nil {
+			return c.String(400, "Not a valid maintenanceId, "+err.Error())
+		}
+
+		err = dao.DeleteMaintenance(maintenanceId, db)
+		if err != nil {
+			return c.String(500, "could not delete maintenance: "+err.Error())
+		}
+		return c.String(200, "maintenance deleted")
+	})
+}
@@ -0,0 +1,140 @@
+package push
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"io/ioutil"
+	"pingr"
+	apiauth "pingr/internal/auth"
+	"pingr/internal/config"
+	"pingr/internal/dao"
+	"pingr/internal/sec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderToken     = "X-Pingr-Token"
+	HeaderTimestamp = "X-Pingr-Timestamp"
+	HeaderSignature = "X-Pingr-Signature"
+
+	// Signed requests older/newer than this are rejected, as are replays within it
+	signatureWindow = 5 * time.Minute
+)
+
+// authorize checks the push token, request signature and source ip of a push, if configured for the test
+func authorize(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		testId := c.Param("test-id")
+		db := c.Get("DB").(*sqlx.DB)
+
+		auth, err := dao.GetPushAuth(testId, db)
+		if err != nil && err != sql.ErrNoRows {
+			return c.String(500, "could not get push authentication: "+err.Error())
+		}
+		configured := err == nil
+
+		if configured && !auth.AllowsIP(c.RealIP()) {
+			return c.String(403, "ip not allowed to push")
+		}
+
+		// API tokens allowed to push can push to any test, in place of its token and signature
+		p, ok, err := apiauth.Pusher(c)
+		if err != nil {
+			return c.String(500, "could not get token: "+err.Error())
+		}
+		if ok {
+			c.Set("User", p.String())
+			return next(c)
+		}
+
+		if !configured {
+			if config.Get().PushAuthRequired {
+				return c.String(401, "push authentication is required but not configured for test")
+			}
+			return next(c)
+		}
+
+		if auth.TokenHash != "" && !sec.CompareToken(pushToken(c), auth.TokenHash) {
+			return c.String(401, "invalid push token")
+		}
+
+		if auth.HMACSecret != "" {
+			reqBody, err := ioutil.ReadAll(c.Request().Body)
+			if err != nil {
+				return c.String(400, "could not read body")
+			}
+			c.Request().Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+
+			err = verifySignature(c, auth, reqBody)
+			if err != nil {
+				return c.String(401, err.Error())
+			}
+			replayed, err := dao.SeenPushSignature(c.Request().Header.Get(HeaderSignature), time.Now(),
+				time.Now().Add(-2*signatureWindow), db)
+			if err != nil {
+				return c.String(500, "could not record signature: "+err.Error())
+			}
+			if replayed {
+				return c.String(401, "request has already been received")
+			}
+		}
+
+		if config.Get().PushAuthRequired && auth.TokenHash == "" && auth.HMACSecret == "" {
+			return c.String(401, "push authentication is required but not configured for test")
+		}
+
+		return next(c)
+	}
+}
+
+func pushToken(c echo.Context) string {
+	if token := c.Request().Header.Get(HeaderToken); token != "" {
+		return token
+	}
+	if authorization := c.Request().Header.Get(echo.HeaderAuthorization); strings.HasPrefix(authorization, "Bearer ") {
+		return strings.TrimPrefix(authorization, "Bearer ")
+	}
+	return ""
+}
+
+// SignatureMessage is what is signed for a push request: "<unix timestamp>\n<method>\n<uri>\n<body>", where the uri
+// is the path along with the query, e.g. "/api/push/<test-id>/job/fail?message=disk%20full"
+func SignatureMessage(timestamp string, method string, uri string, body []byte) []byte {
+	message := []byte(fmt.Sprintf("%s\n%s\n%s\n", timestamp, method, uri))
+	return append(message, body...)
+}
+
+func verifySignature(c echo.Context, auth pingr.PushAuth, body []byte) error {
+	timestamp := c.Request().Header.Get(HeaderTimestamp)
+	signature := c.Request().Header.Get(HeaderSignature)
+	if timestamp == "" || signature == "" {
+		return fmt.Errorf("request has to be signed, missing %s or %s", HeaderTimestamp, HeaderSignature)
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s", HeaderTimestamp)
+	}
+	signedAt := time.Unix(unix, 0)
+	if time.Since(signedAt) > signatureWindow || time.Until(signedAt) > signatureWindow {
+		return fmt.Errorf("%s is outside of the allowed window of %s", HeaderTimestamp, signatureWindow)
+	}
+
+	protected := sec.Protected{Cipher: auth.HMACSecret}
+	err = protected.Open()
+	if err != nil {
+		return fmt.Errorf("could not open push secret: %v", err)
+	}
+
+	message := SignatureMessage(timestamp, c.Request().Method, c.Request().URL.RequestURI(), body)
+	if !sec.VerifySignature(protected.Plain, message, signature) {
+		return fmt.Errorf("invalid %s", HeaderSignature)
+	}
+
+	return nil
+}
@@ -5,8 +5,10 @@ import (
 	"github.com/jmoiron/sqlx"
 	"github.com/labstack/echo/v4"
 	"io/ioutil"
+	"pingr"
 	"pingr/internal/bus"
 	"pingr/internal/dao"
+	"pingr/internal/push"
 )
 
 func Init(g *echo.Group, buz *bus.Bus) {
@@ -26,13 +28,13 @@ func Init(g *echo.Group, buz *bus.Bus) {
 		}
 
 		return context.String(200, "Push request received")
-	})
+	}, authorize)
 
 	g.POST("/:test-id/:vanity-name", func(context echo.Context) error {
 		testId := context.Param("test-id")
 		db := context.Get("DB").(*sqlx.DB)
 
-		_, err := dao.GetTest(testId, db)
+		test, err := dao.GetTest(testId, db)
 		if err != nil {
 			return context.String(400, "invalid testId")
 		}
@@ -41,6 +43,9 @@ func Init(g *echo.Group, buz *bus.Bus) {
 		if err != nil {
 			return context.String(400, "could not read post body")
 		}
+		if _, ok := test.(pingr.HTTPPushTest); ok {
+			reqBody = nil // Not checked, and only job signals are published with data to HTTPPush tests
+		}
 
 		// Notify worker of push retrieval
 		err = buz.Publish(fmt.Sprintf("push:%s", testId), reqBody)
@@ -49,5 +54,47 @@ func Init(g *echo.Group, buz *bus.Bus) {
 		}
 
 		return context.String(200, "Push request received")
-	})
+	}, authorize)
+
+	// Listen to job signals, i.e. start, finish and fail
+	for _, signal := range []push.Signal{push.Start, push.Finish, push.Fail} {
+		signal := signal
+		handler := func(context echo.Context) error {
+			testId := context.Param("test-id")
+			db := context.Get("DB").(*sqlx.DB)
+
+			test, err := dao.GetTest(testId, db)
+			if err != nil {
+				return context.String(400, "invalid testId")
+			}
+			if _, ok := test.(pingr.HTTPPushTest); !ok {
+				return context.String(400, "job signals are only supported by HTTPPush tests")
+			}
+
+			heartbeat := push.Heartbeat{
+				Signal:  signal,
+				Message: context.QueryParam("message"),
+			}
+			if heartbeat.Message == "" && context.Request().Method == "POST" {
+				reqBody, err := ioutil.ReadAll(context.Request().Body)
+				if err != nil {
+					return context.String(400, "could not read post body")
+				}
+				heartbeat.Message = push.Excerpt(reqBody)
+			}
+
+			data, err := heartbeat.Encode()
+			if err != nil {
+				return context.String(500, err.Error())
+			}
+			err = buz.Publish(fmt.Sprintf("push:%s", testId), data)
+			if err != nil {
+				return context.String(500, err.Error())
+			}
+
+			return context.String(200, fmt.Sprintf("Push request received, job signal: %s", signal))
+		}
+		g.GET("/:test-id/:vanity-name/"+string(signal), handler, authorize)
+		g.POST("/:test-id/:vanity-name/"+string(signal), handler, authorize)
+	}
 }
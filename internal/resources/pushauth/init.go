@@ -0,0 +1,196 @@
+package pushauth
+
+import (
+	"database/sql"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"pingr"
+	"pingr/internal/dao"
+	"pingr/internal/sec"
+	"strings"
+	"time"
+)
+
+type pushAuthStatus struct {
+	TestId     string    `json:"test_id"`
+	Token      bool      `json:"token"`
+	Signed     bool      `json:"signed"`
+	AllowedIPs []string  `json:"allowed_ips"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func Init(g *echo.Group) {
+	g.GET("/:testId", func(context echo.Context) error {
+		db := context.Get("DB").(*sqlx.DB)
+		testId := context.Param("testId")
+
+		auth, err := getPushAuth(testId, db)
+		if err != nil {
+			return context.String(400, "could not get push authentication: "+err.Error())
+		}
+
+		return context.JSON(200, pushAuthStatus{
+			TestId:     auth.TestId,
+			Token:      auth.TokenHash != "",
+			Signed:     auth.HMACSecret != "",
+			AllowedIPs: auth.IPs(),
+			UpdatedAt:  auth.UpdatedAt,
+		})
+	})
+
+	// Generate, or rotate, the push token. The token is only returned once
+	g.POST("/:testId/token", func(context echo.Context) error {
+		db := context.Get("DB").(*sqlx.DB)
+		testId := context.Param("testId")
+
+		auth, err := getPushAuth(testId, db)
+		if err != nil {
+			return context.String(400, "could not get push authentication: "+err.Error())
+		}
+
+		token, err := sec.NewToken()
+		if err != nil {
+			return context.String(500, "could not generate token: "+err.Error())
+		}
+		auth.TokenHash = sec.HashToken(token)
+
+		err = putPushAuth(auth, db)
+		if err != nil {
+			return context.String(500, "could not save push token: "+err.Error())
+		}
+
+		return context.JSON(200, map[string]string{"token": token})
+	})
+
+	g.DELETE("/:testId/token", func(context echo.Context) error {
+		db := context.Get("DB").(*sqlx.DB)
+		testId := context.Param("testId")
+
+		auth, err := getPushAuth(testId, db)
+		if err != nil {
+			return context.String(400, "could not get push authentication: "+err.Error())
+		}
+		auth.TokenHash = ""
+
+		err = putPushAuth(auth, db)
+		if err != nil {
+			return context.String(500, "could not remove push token: "+err.Error())
+		}
+
+		return context.String(200, "push token removed")
+	})
+
+	// Generate, or rotate, the secret used to sign push requests. The secret is only returned once
+	g.POST("/:testId/secret", func(context echo.Context) error {
+		db := context.Get("DB").(*sqlx.DB)
+		testId := context.Param("testId")
+
+		auth, err := getPushAuth(testId, db)
+		if err != nil {
+			return context.String(400, "could not get push authentication: "+err.Error())
+		}
+
+		secret, err := sec.NewToken()
+		if err != nil {
+			return context.String(500, "could not generate secret: "+err.Error())
+		}
+		protected := sec.Protected{
+			Plain: secret,
+		}
+		err = protected.Seal()
+		if err != nil {
+			return context.String(500, "could not seal secret: "+err.Error())
+		}
+		auth.HMACSecret = protected.Cipher
+
+		err = putPushAuth(auth, db)
+		if err != nil {
+			return context.String(500, "could not save push secret: "+err.Error())
+		}
+
+		return context.JSON(200, map[string]string{"secret": secret})
+	})
+
+	g.DELETE("/:testId/secret", func(context echo.Context) error {
+		db := context.Get("DB").(*sqlx.DB)
+		testId := context.Param("testId")
+
+		auth, err := getPushAuth(testId, db)
+		if err != nil {
+			return context.String(400, "could not get push authentication: "+err.Error())
+		}
+		auth.HMACSecret = ""
+
+		err = putPushAuth(auth, db)
+		if err != nil {
+			return context.String(500, "could not remove push secret: "+err.Error())
+		}
+
+		return context.String(200, "push secret removed")
+	})
+
+	g.PUT("/:testId/ips", func(context echo.Context) error {
+		db := context.Get("DB").(*sqlx.DB)
+		testId := context.Param("testId")
+
+		var body struct {
+			AllowedIPs []string `json:"allowed_ips"`
+		}
+		if err := context.Bind(&body); err != nil {
+			return context.String(400, "Could not parse body as allowed ips: "+err.Error())
+		}
+
+		auth, err := getPushAuth(testId, db)
+		if err != nil {
+			return context.String(400, "could not get push authentication: "+err.Error())
+		}
+		auth.AllowedIPs = strings.Join(body.AllowedIPs, " ")
+		if !auth.Validate() {
+			return context.String(400, "invalid input: allowed ips")
+		}
+
+		err = putPushAuth(auth, db)
+		if err != nil {
+			return context.String(500, "could not save allowed ips: "+err.Error())
+		}
+
+		return context.String(200, "allowed ips updated")
+	})
+
+	g.DELETE("/:testId", func(context echo.Context) error {
+		db := context.Get("DB").(*sqlx.DB)
+		testId := context.Param("testId")
+
+		err := dao.DeletePushAuth(testId, db)
+		if err != nil {
+			return context.String(500, "could not delete push authentication: "+err.Error())
+		}
+
+		return context.String(200, "push authentication removed")
+	})
+}
+
+// getPushAuth returns the push authentication of a push test, or an empty one if not yet configured
+func getPushAuth(testId string, db *sqlx.DB) (pingr.PushAuth, error) {
+	test, err := dao.GetRawTest(testId, db)
+	if err != nil {
+		return pingr.PushAuth{}, err
+	}
+	switch test.TestType {
+	case "HTTPPush", "PrometheusPush", "JSONPush", "LinePush":
+	default:
+		return pingr.PushAuth{}, errors.New("not a push test")
+	}
+
+	auth, err := dao.GetPushAuth(testId, db)
+	if err == sql.ErrNoRows {
+		return pingr.PushAuth{TestId: testId}, nil
+	}
+	return auth, err
+}
+
+func putPushAuth(auth pingr.PushAuth, db *sqlx.DB) error {
+	auth.UpdatedAt = time.Now()
+	return dao.PutPushAuth(auth, db)
+}
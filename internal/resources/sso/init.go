@@ -0,0 +1,174 @@
+package sso
+
+import (
+	"encoding/json"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+	"net/http"
+	"pingr"
+	"pingr/internal/auth"
+	"pingr/internal/config"
+	"pingr/internal/dao"
+	"pingr/internal/oidc"
+	"pingr/internal/sec"
+	"strings"
+	"time"
+)
+
+// loginCookie holds the sealed state of a login while the user signs in with the identity provider
+const loginCookie = "pingr_login"
+
+// Sessions last at most this long, whatever SESSION_LENGTH is, as the role of a user is only mapped from its
+// groups when signing in
+const maxSessionLength = 12 * time.Hour
+
+// Init adds the endpoints signing in through OpenID Connect, if enabled
+func Init(g *echo.Group) {
+	cfg := config.Get()
+	if cfg.OIDCIssuer == "" {
+		return
+	}
+	baseUrl := strings.TrimRight(cfg.BaseUrl, "/")
+	secure := strings.HasPrefix(baseUrl, "https://")
+	provider := oidc.New(cfg.OIDCIssuer, cfg.OIDCClientId, cfg.OIDCClientSecret, baseUrl+"/api/oidc/callback", cfg.OIDCScopes)
+
+	// Send the user to the identity provider, to come back to ?redirect= once signed in
+	g.GET("/login", func(c echo.Context) error {
+		login, err := oidc.NewLogin(localPath(c.QueryParam("redirect")))
+		if err != nil {
+			return c.String(500, "could not start login: "+err.Error())
+		}
+		authURL, err := provider.AuthURL(c.Request().Context(), login)
+		if err != nil {
+			return c.String(502, "could not reach the identity provider: "+err.Error())
+		}
+
+		data, err := json.Marshal(login)
+		if err != nil {
+			return c.String(500, "could not marshal login: "+err.Error())
+		}
+		sealed := sec.Protected{Plain: string(data)}
+		err = sealed.Seal()
+		if err != nil {
+			return c.String(500, "could not seal login: "+err.Error())
+		}
+		c.SetCookie(&http.Cookie{
+			Name:     loginCookie,
+			Value:    sealed.Cipher,
+			Path:     "/api/oidc",
+			Expires:  login.ExpiresAt,
+			HttpOnly: true,
+			Secure:   secure,
+			SameSite: http.SameSiteLaxMode, // Sent along when the identity provider redirects back
+		})
+		return c.Redirect(302, authURL)
+	})
+
+	// Where the identity provider sends the user back to, with a code to exchange for the identity of the user
+	g.GET("/callback", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		logger := logrus.WithContext(c.Request().Context())
+
+		if e := c.QueryParam("error"); e != "" {
+			return c.String(401, "sign in failed: "+e+" "+c.QueryParam("error_description"))
+		}
+
+		cookie, err := c.Cookie(loginCookie)
+		if err != nil {
+			return c.String(400, "sign in failed: no login in progress")
+		}
+		c.SetCookie(&http.Cookie{Name: loginCookie, Path: "/api/oidc", MaxAge: -1, HttpOnly: true, Secure: secure})
+		sealed := sec.Protected{Cipher: cookie.Value}
+		var login oidc.Login
+		if sealed.Open() != nil || json.Unmarshal([]byte(sealed.Plain), &login) != nil {
+			return c.String(400, "sign in failed: invalid login")
+		}
+		if time.Now().After(login.ExpiresAt) {
+			return c.String(400, "sign in failed: the login has expired, try again")
+		}
+		if c.QueryParam("state") != login.State {
+			return c.String(400, "sign in failed: state does not match the login")
+		}
+
+		claims, err := provider.Exchange(c.Request().Context(), c.QueryParam("code"), login)
+		if err != nil {
+			logger.WithError(err).Warn("OpenID Connect sign in failed")
+			return c.String(401, "sign in failed: "+err.Error())
+		}
+
+		username := claims.Username()
+		role := oidc.Role(claims.Strings(cfg.OIDCGroupsClaim), cfg.OIDCGroupRoles, cfg.OIDCDefaultRole)
+		if !pingr.ValidRole(role) {
+			logger.WithField("username", username).Warn("OpenID Connect sign in of a user without a role")
+			return c.String(403, "forbidden: "+username+" is not in any group with access to pingr")
+		}
+
+		token, err := sec.NewToken()
+		if err != nil {
+			return c.String(500, "could not generate session: "+err.Error())
+		}
+		length := cfg.SessionLength
+		if length > maxSessionLength {
+			length = maxSessionLength
+		}
+		now := time.Now()
+		session := pingr.Session{
+			SessionHash: sec.HashToken(token),
+			Subject:     claims.String("sub"),
+			Username:    username,
+			Role:        role,
+			CreatedAt:   now,
+			ExpiresAt:   now.Add(length),
+		}
+		err = dao.DeleteExpiredSessions(now, db)
+		if err != nil {
+			return c.String(500, "could not delete expired sessions: "+err.Error())
+		}
+		err = dao.PostSession(session, db)
+		if err != nil {
+			return c.String(500, "could not save session: "+err.Error())
+		}
+		logger.WithField("username", username).WithField("role", role).Info("Signed in through OpenID Connect")
+
+		c.SetCookie(&http.Cookie{
+			Name:     auth.SessionCookie,
+			Value:    token,
+			Path:     "/",
+			Expires:  session.ExpiresAt,
+			HttpOnly: true,
+			Secure:   secure,
+			SameSite: http.SameSiteLaxMode,
+		})
+		return c.Redirect(302, login.Redirect)
+	})
+
+	// End the session, and that of the identity provider if it supports it. Only from the UI, not to be signed out
+	// by other sites
+	g.POST("/logout", func(c echo.Context) error {
+		if !auth.SameOrigin(c.Request()) {
+			return c.String(403, "forbidden: cross-origin request")
+		}
+		db := c.Get("DB").(*sqlx.DB)
+		if cookie, err := c.Cookie(auth.SessionCookie); err == nil {
+			err = dao.DeleteSession(sec.HashToken(cookie.Value), db)
+			if err != nil {
+				return c.String(500, "could not delete session: "+err.Error())
+			}
+		}
+		auth.ClearSession(c)
+
+		if u := provider.EndSessionURL(c.Request().Context(), baseUrl+"/"); u != "" {
+			return c.Redirect(302, u)
+		}
+		return c.Redirect(302, "/")
+	})
+}
+
+// localPath only lets the user be redirected within pingr once signed in
+func localPath(p string) string {
+	if !strings.HasPrefix(p, "/") || strings.HasPrefix(p, "//") || strings.HasPrefix(p, "/\\") {
+		return "/"
+	}
+	return p
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/google/uuid"
@@ -9,15 +10,19 @@ import (
 	"pingr"
 	"pingr/internal/bus"
 	"pingr/internal/dao"
+	"pingr/internal/ha"
+	"strconv"
 	"time"
 )
 
 func Init(g *echo.Group, buz *bus.Bus) {
+	initTags(g, buz)
+
 	// Get all Tests
 	g.GET("", func(c echo.Context) error {
 		db := c.Get("DB").(*sqlx.DB)
 
-		tests, err := dao.GetRawTests(db)
+		tests, err := dao.GetTaggedTests(c.QueryParams()["tag"], db)
 		if err != nil {
 			return c.String(500, "Failed to get test: "+err.Error())
 		}
@@ -53,7 +58,7 @@ func Init(g *echo.Group, buz *bus.Bus) {
 	g.GET("/status", func(c echo.Context) error {
 		db := c.Get("DB").(*sqlx.DB)
 
-		testStatus, err := dao.GetTestsStatus(db)
+		testStatus, err := dao.GetTaggedTestsStatus(c.QueryParams()["tag"], db)
 		if err != nil {
 			return c.String(500, "Failed to get test, "+err.Error())
 		}
@@ -61,11 +66,47 @@ func Init(g *echo.Group, buz *bus.Bus) {
 		return c.JSON(200, testStatus)
 	})
 
+	// Get the tests currently flapping
+	g.GET("/flapping", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+
+		flapping, err := dao.GetAllFlapping(db)
+		if err != nil {
+			return c.String(500, "Failed to get flapping tests, "+err.Error())
+		}
+
+		return c.JSON(200, flapping)
+	})
+
 	// Get a Test's Logs
 	g.GET("/:testId/logs", func(c echo.Context) error {
 		db := c.Get("DB").(*sqlx.DB)
 		testId := c.Param("testId")
 
+		// Only the latest ?limit=n logs, and/or the logs added after ?after=<log id>, e.g. to follow the test
+		if c.QueryParam("after") != "" || c.QueryParam("limit") != "" {
+			var after uint64
+			limit := -1
+			var err error
+			if c.QueryParam("after") != "" {
+				after, err = strconv.ParseUint(c.QueryParam("after"), 10, 64)
+				if err != nil {
+					return c.String(400, "invalid input: after: "+err.Error())
+				}
+			}
+			if c.QueryParam("limit") != "" {
+				limit, err = strconv.Atoi(c.QueryParam("limit"))
+				if err != nil {
+					return c.String(400, "invalid input: limit: "+err.Error())
+				}
+			}
+			logs, err := dao.GetTestLogsAfter(testId, after, limit, db)
+			if err != nil {
+				return c.String(500, "Failed to get the test's logs, "+err.Error())
+			}
+			return c.JSON(200, logs)
+		}
+
 		logs, err := dao.GetTestLogs(testId, db)
 		if err != nil {
 			return c.String(500, "Failed to get the test's logs, "+err.Error())
@@ -111,14 +152,7 @@ func Init(g *echo.Group, buz *bus.Bus) {
 			return c.String(500, "Could not add Test to DB, "+err.Error())
 		}
 
-		data, err := json.Marshal(testDB)
-		if err != nil {
-			return c.String(500, fmt.Sprintf("could not marchal test: %s", err.Error()))
-		}
-		err = buz.Publish("new", data)
-		if err != nil {
-			return c.String(500, fmt.Sprintf("unable to publish new test: %s", err.Error()))
-		}
+		notifyChange(buz)
 
 		return c.JSON(200, testDB)
 	})
@@ -130,10 +164,7 @@ func Init(g *echo.Group, buz *bus.Bus) {
 		if err != nil {
 			return c.String(400, "could not deactivate test: "+err.Error())
 		}
-		err = buz.Publish("deactivate", []byte(testId))
-		if err != nil {
-			return c.String(400, "could not publish deactivation: "+err.Error())
-		}
+		notifyChange(buz)
 
 		return c.String(200, "test paused")
 	})
@@ -146,22 +177,144 @@ func Init(g *echo.Group, buz *bus.Bus) {
 		if err != nil {
 			return c.String(400, "invalid test id: "+err.Error())
 		}
+		test.Active = true
+		if !test.Validate() {
+			return c.String(400, "invalid input: the test is incomplete, e.g. an SSH test imported without its credential")
+		}
 
 		err = dao.ActivateTest(testId, db)
 		if err != nil {
 			return c.String(400, "could not activate test: "+err.Error())
 		}
+		notifyChange(buz)
+
+		return c.String(200, "test activated")
+	})
+
+	// Run a stored test right away, through the scheduler, and return the resulting log
+	g.POST("/:testId/run", func(c echo.Context) error {
+		if !ha.IsLeader() {
+			return c.String(503, "not the leader, tests are only run by the leader")
+		}
+		db := c.Get("DB").(*sqlx.DB)
+		testId := c.Param("testId")
+
+		test, err := dao.GetRawTest(testId, db)
+		if err != nil {
+			return c.String(400, "invalid test id: "+err.Error())
+		}
+		if isPush(test) {
+			return c.String(400, "push tests can not be run on request")
+		}
+		if !test.Active {
+			return c.String(400, "paused tests can not be run on request")
+		}
+
+		l, runErr := runTest(c.Request().Context(), test, buz)
+		if runErr != nil {
+			return c.String(runErr.code, runErr.Error())
+		}
+		return c.JSON(200, l)
+	})
+
+	// Get the parents a test depends on
+	g.GET("/:testId/parents", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		testId := c.Param("testId")
+
+		parents, err := dao.GetTestParents(testId, db)
+		if err != nil {
+			return c.String(500, "could not get test parents: "+err.Error())
+		}
+
+		return c.JSON(200, map[string][]string{"parent_ids": parents})
+	})
+
+	// Set the parents a test depends on, notifications are suppressed while a parent is failing
+	g.PUT("/:testId/parents", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		testId := c.Param("testId")
+
+		var body struct {
+			ParentIds []string `json:"parent_ids"`
+		}
+		if err := c.Bind(&body); err != nil {
+			return c.String(400, "Could not parse body as parent ids: "+err.Error())
+		}
 
-		data, err := json.Marshal(test)
+		_, err := dao.GetRawTest(testId, db)
 		if err != nil {
-			return c.String(500, fmt.Sprintf("could not marchal test: %s", err.Error()))
+			return c.String(400, "invalid test id: "+err.Error())
 		}
-		err = buz.Publish("new", data)
+		for _, parentId := range body.ParentIds {
+			_, err := dao.GetRawTest(parentId, db)
+			if err != nil {
+				return c.String(400, "invalid parent id: "+parentId)
+			}
+		}
+
+		deps, err := dao.GetTestDependencies(db)
 		if err != nil {
-			return c.String(400, "could not publish activation: "+err.Error())
+			return c.String(500, "could not get test dependencies: "+err.Error())
+		}
+		if dependsOn(testId, body.ParentIds, deps) {
+			return c.String(400, "invalid input: circular dependency")
 		}
 
-		return c.String(200, "test activated")
+		err = dao.PutTestParents(testId, body.ParentIds, db)
+		if err != nil {
+			return c.String(500, "could not save test parents: "+err.Error())
+		}
+
+		return c.String(200, "test parents updated")
+	})
+
+	// Get the locations a test is run from, empty if it is only run locally
+	g.GET("/:testId/locations", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		testId := c.Param("testId")
+
+		locations, err := dao.GetTestLocations(testId, db)
+		if err != nil {
+			return c.String(500, "could not get test locations: "+err.Error())
+		}
+
+		return c.JSON(200, map[string][]string{"locations": locations})
+	})
+
+	// Set the locations a test is run from, by agents or by pingrd itself as "local"
+	g.PUT("/:testId/locations", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		testId := c.Param("testId")
+
+		var body struct {
+			Locations []string `json:"locations"`
+		}
+		if err := c.Bind(&body); err != nil {
+			return c.String(400, "Could not parse body as locations: "+err.Error())
+		}
+
+		test, err := dao.GetRawTest(testId, db)
+		if err != nil {
+			return c.String(400, "invalid test id: "+err.Error())
+		}
+		for _, location := range body.Locations {
+			if location == "" {
+				return c.String(400, "invalid input: empty location")
+			}
+			if location != pingr.LocalLocation && !test.RemoteCapable() {
+				return c.String(400, "invalid input: "+test.TestType+" tests can only be run locally")
+			}
+		}
+
+		err = dao.PutTestLocations(testId, body.Locations, db)
+		if err != nil {
+			return c.String(500, "could not save test locations: "+err.Error())
+		}
+
+		notifyChange(buz) // Starts, or stops, the local worker of the test
+
+		return c.String(200, "test locations updated")
 	})
 
 	// Update Test
@@ -183,6 +336,9 @@ func Init(g *echo.Group, buz *bus.Bus) {
 		if err != nil {
 			return c.String(400, "could not mask sensitive test data: "+err.Error())
 		}
+		if testDB.Tags == nil {
+			testDB.Tags = testDb.Tags // Left unchanged
+		}
 
 		if !testDB.Validate() {
 			return c.String(400, "invalid input: Test")
@@ -193,16 +349,7 @@ func Init(g *echo.Group, buz *bus.Bus) {
 			return c.String(500, "Could not update Test, "+err.Error())
 		}
 
-		if testDB.Active {
-			data, err := json.Marshal(testDB)
-			if err != nil {
-				return c.String(500, fmt.Sprintf("could not marchal test: %s", err.Error()))
-			}
-			err = buz.Publish("new", data)
-			if err != nil {
-				return c.String(500, fmt.Sprintf("unable to publish new test: %s", err.Error()))
-			}
-		}
+		notifyChange(buz)
 
 		return c.JSON(200, testDB)
 	})
@@ -217,30 +364,12 @@ func Init(g *echo.Group, buz *bus.Bus) {
 			return c.String(400, "Not a valid/active testId, "+err.Error())
 		}
 
-		err = dao.DeleteTest(testId, db)
-		if err != nil {
-			return c.String(500, "Could not delete Test, "+err.Error())
-		}
-
-		err = dao.DeleteTestContacts(testId, db)
-		if err != nil {
-			return c.String(500, "Could not delete the test's contacts: "+err.Error())
-		}
-
-		err = dao.DeleteTestLogs(testId, db)
-		if err != nil {
-			return c.String(500, "Could not delete the test's logs: "+err.Error())
-		}
-
-		err = dao.CloseTestIncident(testId, db)
+		err = dao.PurgeTest(testId, db)
 		if err != nil {
-			return c.String(500, "Could not close the test's incident: "+err.Error())
+			return c.String(500, err.Error())
 		}
 
-		err = buz.Publish("delete", []byte(testId))
-		if err != nil {
-			return c.String(500, fmt.Sprintf("unable to publish deletion: %s", err.Error()))
-		}
+		notifyChange(buz)
 
 		return c.String(200, "Test deleted")
 	})
@@ -272,11 +401,100 @@ func Init(g *echo.Group, buz *bus.Bus) {
 			return c.String(400, "Could not parse test data: "+err.Error())
 		}
 
-		rt, err := pTest.RunTest(buz)
+		ctx, cancel := context.WithTimeout(c.Request().Context(), pTest.Deadline())
+		defer cancel()
+		rt, excerpt, err := testDB.RunTestExcerpt(ctx, buz)
 		if err != nil {
 			return c.String(200, "test failed: "+err.Error())
 		}
+		if excerpt != "" {
+			return c.String(200, "test succeeded. response time: "+rt.Round(time.Millisecond).String()+", "+excerpt)
+		}
 		return c.String(200, "test succeeded. response time: "+rt.Round(time.Millisecond).String())
 	})
 
 }
+
+type runError struct {
+	code int
+	msg  string
+}
+
+func (e *runError) Error() string {
+	return e.msg
+}
+
+// runTest has the scheduler run the test right away and waits for the resulting log
+func runTest(ctx context.Context, test pingr.GenericTest, buz *bus.Bus) (pingr.Log, *runError) {
+	var l pingr.Log
+	req := pingr.RunRequest{
+		Test:       test,
+		ReplyTopic: fmt.Sprintf("run:%s", uuid.New().String()),
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return l, &runError{500, fmt.Sprintf("could not marchal run request: %s", err.Error())}
+	}
+	defer buz.Close(req.ReplyTopic)
+
+	// The run may have to wait for a free slot before its deadline starts
+	ctx, cancel := context.WithTimeout(ctx, test.Deadline()+time.Minute)
+	defer cancel()
+
+	// Run requests are taken off the bus right away, retry while it is busy with other requests
+	for {
+		err = buz.Publish("run", data)
+		if err == nil {
+			break
+		}
+		select {
+		case <-time.After(10 * time.Millisecond):
+		case <-ctx.Done():
+			return l, &runError{503, "could not publish run request: " + err.Error()}
+		}
+	}
+
+	data, err = buz.NextContext(ctx, req.ReplyTopic)
+	if err != nil {
+		return l, &runError{504, "no test result received: " + err.Error()}
+	}
+
+	err = json.Unmarshal(data, &l)
+	if err != nil {
+		return l, &runError{500, "could not parse test result: " + err.Error()}
+	}
+	return l, nil
+}
+
+func isPush(test pingr.GenericTest) bool {
+	switch test.TestType {
+	case "HTTPPush", "PrometheusPush", "JSONPush", "LinePush":
+		return true
+	}
+	return false
+}
+
+// notifyChange wakes up the scheduler to pick up the change recorded along with an edit. It is only a hint,
+// the change is picked up within seconds anyway if the bus is full
+func notifyChange(buz *bus.Bus) {
+	_ = buz.Publish("changes", nil)
+}
+
+// dependsOn reports whether any of the parents is, or transitively depends on, the test
+func dependsOn(testId string, parentIds []string, deps map[string][]string) bool {
+	visited := map[string]bool{}
+	queue := append([]string{}, parentIds...)
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if id == testId {
+			return true
+		}
+		if visited[id] {
+			continue
+		}
+		visited[id] = true
+		queue = append(queue, deps[id]...)
+	}
+	return false
+}
@@ -0,0 +1,211 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"pingr"
+	"pingr/internal/bus"
+	"pingr/internal/dao"
+	"pingr/internal/ha"
+	"sync"
+)
+
+type tagRun struct {
+	TestId string     `json:"test_id"`
+	Log    *pingr.Log `json:"log,omitempty"`
+	Error  string     `json:"error,omitempty"`
+}
+
+// initTags adds the endpoints acting on every test tagged with a tag at once
+func initTags(g *echo.Group, buz *bus.Bus) {
+	// Get all tags, with the number of tests tagged by each
+	g.GET("/tags", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+
+		tags, err := dao.GetTags(db)
+		if err != nil {
+			return c.String(500, "could not get tags: "+err.Error())
+		}
+
+		return c.JSON(200, tags)
+	})
+
+	// Pause all tests tagged with the tag
+	g.PUT("/tags/:tag/deactivate", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+
+		tests, err := dao.GetTaggedTests([]string{c.Param("tag")}, db)
+		if err != nil {
+			return c.String(500, "could not get tests: "+err.Error())
+		}
+
+		toggle := toggled(tests, false)
+		for _, test := range toggle {
+			err = dao.DeactivateTest(test.TestId, db)
+			if err != nil {
+				return c.String(500, "could not deactivate test: "+err.Error())
+			}
+		}
+		notifyChange(buz)
+
+		return c.String(200, fmt.Sprintf("%d tests paused", len(toggle)))
+	})
+
+	// Resume all tests tagged with the tag
+	g.PUT("/tags/:tag/activate", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+
+		tests, err := dao.GetTaggedTests([]string{c.Param("tag")}, db)
+		if err != nil {
+			return c.String(500, "could not get tests: "+err.Error())
+		}
+
+		var n int
+		for _, test := range toggled(tests, true) {
+			test.Active = true
+			if !test.Validate() {
+				continue // Incomplete, e.g. an SSH test imported without its credential
+			}
+			err = dao.ActivateTest(test.TestId, db)
+			if err != nil {
+				return c.String(500, "could not activate test: "+err.Error())
+			}
+			n++
+		}
+		notifyChange(buz)
+
+		return c.String(200, fmt.Sprintf("%d tests activated", n))
+	})
+
+	// Delete all tests tagged with the tag
+	g.DELETE("/tags/:tag", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+
+		tests, err := dao.GetTaggedTests([]string{c.Param("tag")}, db)
+		if err != nil {
+			return c.String(500, "could not get tests: "+err.Error())
+		}
+
+		for _, test := range tests {
+			err = dao.PurgeTest(test.TestId, db)
+			if err != nil {
+				return c.String(500, err.Error())
+			}
+		}
+		notifyChange(buz)
+
+		return c.String(200, fmt.Sprintf("%d tests deleted", len(tests)))
+	})
+
+	// Run all tests tagged with the tag right away, push tests excluded, and return the resulting logs
+	g.POST("/tags/:tag/run", func(c echo.Context) error {
+		if !ha.IsLeader() {
+			return c.String(503, "not the leader, tests are only run by the leader")
+		}
+		db := c.Get("DB").(*sqlx.DB)
+
+		tests, err := dao.GetTaggedTests([]string{c.Param("tag")}, db)
+		if err != nil {
+			return c.String(500, "could not get tests: "+err.Error())
+		}
+
+		runnable := runnable(tests)
+		runs := make([]tagRun, len(runnable))
+		var wg sync.WaitGroup
+		for i, test := range runnable {
+			runs[i].TestId = test.TestId
+			wg.Add(1)
+			go func(run *tagRun, test pingr.GenericTest) {
+				defer wg.Done()
+				l, err := runTest(c.Request().Context(), test, buz)
+				if err != nil {
+					run.Error = err.Error()
+					return
+				}
+				run.Log = &l
+			}(&runs[i], test)
+		}
+		wg.Wait()
+
+		return c.JSON(200, runs)
+	})
+
+	// Add contacts to all tests tagged with the tag, updating the threshold of contacts already added
+	g.POST("/tags/:tag/contacts", func(c echo.Context) error {
+		var body struct {
+			Contacts []pingr.TestContact `json:"contacts"`
+		}
+		if err := c.Bind(&body); err != nil {
+			return c.String(400, "Could not parse body as test contact type: "+err.Error())
+		}
+		contacts := body.Contacts
+		if len(contacts) == 0 {
+			return c.String(400, "Could not parse body as test contact type")
+		}
+
+		db := c.Get("DB").(*sqlx.DB)
+		for _, contact := range contacts {
+			_, err := dao.GetContact(contact.ContactId, db)
+			if err != nil {
+				return c.String(400, "no matching contact id: "+contact.ContactId)
+			}
+		}
+
+		tests, err := dao.GetTaggedTests([]string{c.Param("tag")}, db)
+		if err != nil {
+			return c.String(500, "could not get tests: "+err.Error())
+		}
+
+		testContacts, ok := withContacts(tests, contacts)
+		if !ok {
+			return c.String(400, "invalid input: TestContact")
+		}
+
+		for _, contact := range testContacts {
+			err = dao.PutTestContact(contact, db)
+			if err != nil {
+				return c.String(500, "could not add test contact to db: "+err.Error())
+			}
+		}
+
+		return c.String(200, fmt.Sprintf("contacts added to %d tests", len(tests)))
+	})
+}
+
+// toggled returns the tests that are not already active, or inactive
+func toggled(tests []pingr.GenericTest, active bool) []pingr.GenericTest {
+	var toggle []pingr.GenericTest
+	for _, test := range tests {
+		if test.Active != active {
+			toggle = append(toggle, test)
+		}
+	}
+	return toggle
+}
+
+// runnable returns the tests that can be run on request, i.e. active tests other than push tests
+func runnable(tests []pingr.GenericTest) []pingr.GenericTest {
+	var run []pingr.GenericTest
+	for _, test := range tests {
+		if !isPush(test) && test.Active {
+			run = append(run, test)
+		}
+	}
+	return run
+}
+
+// withContacts returns the contacts added to each of the tests, false if any is invalid
+func withContacts(tests []pingr.GenericTest, contacts []pingr.TestContact) ([]pingr.TestContact, bool) {
+	var testContacts []pingr.TestContact
+	for _, test := range tests {
+		for _, contact := range contacts {
+			contact.TestId = test.TestId
+			if !contact.Validate() {
+				return nil, false
+			}
+			testContacts = append(testContacts, contact)
+		}
+	}
+	return testContacts, true
+}
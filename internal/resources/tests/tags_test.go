@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"pingr"
+	"testing"
+)
+
+func tagged() []pingr.GenericTest {
+	test := func(id string, testType string, active bool) pingr.GenericTest {
+		return pingr.GenericTest{BaseTest: pingr.BaseTest{TestId: id, TestType: testType, Active: active}}
+	}
+	return []pingr.GenericTest{
+		test("http", "HTTP", true),
+		test("paused", "HTTP", false),
+		test("push", "HTTPPush", true),
+		test("paused-push", "JSONPush", false),
+	}
+}
+
+func ids(tests []pingr.GenericTest) []string {
+	var ids []string
+	for _, test := range tests {
+		ids = append(ids, test.TestId)
+	}
+	return ids
+}
+
+func equal(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestToggled(t *testing.T) {
+	if got, exp := ids(toggled(tagged(), false)), []string{"http", "push"}; !equal(got, exp) {
+		t.Logf("expected %v to be paused, got %v", exp, got)
+		t.Fail()
+	}
+	if got, exp := ids(toggled(tagged(), true)), []string{"paused", "paused-push"}; !equal(got, exp) {
+		t.Logf("expected %v to be activated, got %v", exp, got)
+		t.Fail()
+	}
+}
+
+func TestRunnable(t *testing.T) {
+	if got, exp := ids(runnable(tagged())), []string{"http"}; !equal(got, exp) {
+		t.Logf("expected %v to be run, got %v", exp, got)
+		t.Fail()
+	}
+}
+
+func TestWithContacts(t *testing.T) {
+	contacts := []pingr.TestContact{{ContactId: "ops", Threshold: 1}, {ContactId: "oncall", Threshold: 3}}
+	testContacts, ok := withContacts(tagged()[:2], contacts)
+	if !ok || len(testContacts) != 4 {
+		t.Fatalf("expected 4 test contacts, got %v", testContacts)
+	}
+	for i, exp := range []pingr.TestContact{
+		{TestId: "http", ContactId: "ops", Threshold: 1},
+		{TestId: "http", ContactId: "oncall", Threshold: 3},
+		{TestId: "paused", ContactId: "ops", Threshold: 1},
+		{TestId: "paused", ContactId: "oncall", Threshold: 3},
+	} {
+		if testContacts[i] != exp {
+			t.Logf("expected %+v, got %+v", exp, testContacts[i])
+			t.Fail()
+		}
+	}
+
+	if _, ok := withContacts(tagged(), []pingr.TestContact{{ContactId: "ops"}}); ok {
+		t.Log("expected a contact without threshold to be invalid")
+		t.Fail()
+	}
+	if testContacts, ok := withContacts(nil, contacts); !ok || len(testContacts) != 0 {
+		t.Logf("expected no test contacts without tests, got %v", testContacts)
+		t.Fail()
+	}
+}
@@ -0,0 +1,49 @@
+package transfer
+
+import (
+	"encoding/json"
+	"pingr"
+	"pingr/internal/sec"
+)
+
+// withCredential returns the test with the credential of an SSH test replaced by f of it
+func withCredential(t pingr.GenericTest, f func(string) (string, error)) (pingr.GenericTest, error) {
+	if t.TestType != "SSH" {
+		return t, nil
+	}
+	var ssh pingr.SSHTest
+	err := json.Unmarshal(t.Blob, &ssh.Blob)
+	if err != nil {
+		return t, err
+	}
+	ssh.Blob.Credential, err = f(ssh.Blob.Credential)
+	if err != nil {
+		return t, err
+	}
+	blob, err := json.Marshal(ssh.Blob)
+	if err != nil {
+		return t, err
+	}
+	t.Blob = blob
+	return t, nil
+}
+
+// credential returns the credential of an SSH test, empty for other tests
+func credential(t pingr.GenericTest) (string, error) {
+	var c string
+	_, err := withCredential(t, func(credential string) (string, error) {
+		c = credential
+		return credential, nil
+	})
+	return c, err
+}
+
+// open returns the plain text of a credential sealed with the AES key of the service
+func open(cipher string) (string, error) {
+	if cipher == "" {
+		return "", nil
+	}
+	p := sec.Protected{Cipher: cipher}
+	err := p.Open()
+	return p.Plain, err
+}
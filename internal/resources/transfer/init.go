@@ -0,0 +1,387 @@
+package transfer
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"pingr"
+	"pingr/internal/bus"
+	"pingr/internal/dao"
+	"pingr/internal/gitops"
+	"pingr/internal/sec"
+	"sort"
+	"time"
+)
+
+const exportVersion = 1
+
+// Export is the full configuration, in the same shapes as the API. Credentials are either sealed with a key
+// derived from a passphrase and the salt, or omitted
+type Export struct {
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	Salt       string    `json:"salt,omitempty"` // base64, empty if credentials are omitted
+	gitops.Declared
+}
+
+// Change is what importing an object does, or would do on a dry run
+type Change struct {
+	ObjectType string   `json:"object_type"`
+	ObjectId   string   `json:"object_id"`
+	Action     string   `json:"action"`           // create, update, unchanged, conflict or skip
+	Fields     []string `json:"fields,omitempty"` // changed fields of updated, conflicting or skipped objects
+	Note       string   `json:"note,omitempty"`
+}
+
+func Init(export *echo.Group, imp *echo.Group, buz *bus.Bus) {
+	// Export all tests, contacts and test contacts. Credentials are sealed with the passphrase in the
+	// X-Passphrase header, or omitted without it
+	export.GET("", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+
+		ex := Export{
+			Version:    exportVersion,
+			ExportedAt: time.Now(),
+		}
+
+		seal := func(string) (string, error) { return "", nil }
+		if passphrase := c.Request().Header.Get("X-Passphrase"); passphrase != "" {
+			salt, err := sec.NewSalt()
+			if err != nil {
+				return c.String(500, "could not create salt: "+err.Error())
+			}
+			key, err := sec.PassphraseKey(passphrase, salt)
+			if err != nil {
+				return c.String(500, "could not derive key: "+err.Error())
+			}
+			ex.Salt = base64.StdEncoding.EncodeToString(salt)
+			seal = func(plain string) (string, error) {
+				p := sec.Protected{Plain: plain}
+				err := p.SealWith(key)
+				return p.Cipher, err
+			}
+		}
+
+		tests, err := dao.GetRawTests(db)
+		if err != nil {
+			return c.String(500, "could not get tests: "+err.Error())
+		}
+		for _, t := range tests {
+			t, err = withCredential(t, func(cipher string) (string, error) {
+				plain, err := open(cipher)
+				if err != nil {
+					return "", err
+				}
+				return seal(plain)
+			})
+			if err != nil {
+				return c.String(500, "could not export credentials of "+t.TestId+": "+err.Error())
+			}
+			ex.Tests = append(ex.Tests, t)
+		}
+
+		ex.Contacts, err = dao.GetContacts(db)
+		if err != nil {
+			return c.String(500, "could not get contacts: "+err.Error())
+		}
+		ex.TestContacts, err = dao.GetAllTestContacts(db)
+		if err != nil {
+			return c.String(500, "could not get test contacts: "+err.Error())
+		}
+
+		c.Response().Header().Set(echo.HeaderContentDisposition, "attachment; filename=pingr-export.json")
+		return c.JSON(200, ex)
+	})
+
+	// Import an export. Nothing is changed with ?dry_run=true, only the changes are returned. Objects that exist
+	// and differ are conflicts, failing the import unless ?on_conflict=skip or ?on_conflict=overwrite
+	imp.POST("", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		dryRun := c.QueryParam("dry_run") == "true"
+		onConflict := c.QueryParam("on_conflict")
+		switch onConflict {
+		case "":
+			onConflict = "fail"
+		case "fail", "skip", "overwrite":
+		default:
+			return c.String(400, "invalid input: on_conflict has to be fail, skip or overwrite")
+		}
+
+		var ex Export
+		if err := json.NewDecoder(c.Request().Body).Decode(&ex); err != nil {
+			return c.String(400, "Could not parse body as export: "+err.Error())
+		}
+		if ex.Version != exportVersion {
+			return c.String(400, "invalid input: unsupported export version")
+		}
+
+		currentTests := map[string]pingr.GenericTest{}
+		tests, err := dao.GetRawTests(db)
+		if err != nil {
+			return c.String(500, "could not get tests: "+err.Error())
+		}
+		for _, t := range tests {
+			currentTests[t.TestId], err = withCredential(t, open)
+			if err != nil {
+				return c.String(500, "could not open credentials of "+t.TestId+": "+err.Error())
+			}
+		}
+
+		// Credentials are opened with the passphrase, or kept as they are when omitted from the export
+		unseal := func(string) (string, error) { return "", nil }
+		if ex.Salt != "" {
+			salt, err := base64.StdEncoding.DecodeString(ex.Salt)
+			if err != nil {
+				return c.String(400, "invalid input: salt: "+err.Error())
+			}
+			passphrase := c.Request().Header.Get("X-Passphrase")
+			if passphrase == "" {
+				return c.String(400, "invalid input: the export has credentials, set the passphrase in X-Passphrase")
+			}
+			key, err := sec.PassphraseKey(passphrase, salt)
+			if err != nil {
+				return c.String(500, "could not derive key: "+err.Error())
+			}
+			unseal = func(cipher string) (string, error) {
+				p := sec.Protected{Cipher: cipher}
+				err := p.OpenWith(key)
+				if err != nil {
+					return "", errors.New("wrong passphrase? " + err.Error())
+				}
+				return p.Plain, nil
+			}
+		}
+		// New tests with credentials omitted are created paused, without them
+		omitted := map[string]bool{}
+		for i, t := range ex.Tests {
+			ex.Tests[i], err = withCredential(t, func(cipher string) (string, error) {
+				if cipher != "" {
+					return unseal(cipher)
+				}
+				current, ok := currentTests[t.TestId]
+				if !ok {
+					omitted[t.TestId] = true
+					return "", nil
+				}
+				return credential(current)
+			})
+			if err != nil {
+				return c.String(400, "invalid input: credentials of "+t.TestId+": "+err.Error())
+			}
+			if omitted[t.TestId] {
+				ex.Tests[i].Active = false
+			}
+			if ex.Tests[i].Tags == nil {
+				ex.Tests[i].Tags = []string{}
+			}
+		}
+
+		err = ex.Validate()
+		if err != nil {
+			return c.String(400, "invalid input: "+err.Error())
+		}
+
+		changes, err := diff(ex.Declared, currentTests, db)
+		if err != nil {
+			return c.String(500, "could not compare the export: "+err.Error())
+		}
+		conflicts := false
+		for i := range changes {
+			if changes[i].ObjectType == "test" && omitted[changes[i].ObjectId] {
+				changes[i].Note = "paused, the credential was omitted from the export, set it before activating the test"
+			}
+			if changes[i].Action != "conflict" {
+				continue
+			}
+			switch onConflict {
+			case "fail":
+				conflicts = true
+			case "skip":
+				changes[i].Action = "skip"
+			case "overwrite":
+				changes[i].Action = "update"
+			}
+		}
+		if dryRun {
+			return c.JSON(200, changes)
+		}
+		if conflicts {
+			return c.JSON(409, changes)
+		}
+
+		err = dao.InTx(db, func(tx *sqlx.Tx) error {
+			return apply(ex.Declared, changes, currentTests, tx)
+		})
+		if err != nil {
+			return c.String(500, "could not import, nothing was changed: "+err.Error())
+		}
+		// Picked up by the scheduler within seconds anyway if the bus is full
+		_ = buz.Publish("changes", nil)
+
+		return c.JSON(200, changes)
+	})
+}
+
+// diff returns the change importing each object makes, with conflicts for objects existing and differing
+func diff(d gitops.Declared, currentTests map[string]pingr.GenericTest, db *sqlx.DB) ([]Change, error) {
+	changes := []Change{}
+
+	contacts, err := dao.GetContacts(db)
+	if err != nil {
+		return nil, err
+	}
+	currentContacts := map[string]pingr.Contact{}
+	for _, contact := range contacts {
+		currentContacts[contact.ContactId] = contact
+	}
+	for _, contact := range d.Contacts {
+		current, ok := currentContacts[contact.ContactId]
+		change, err := diffObject("contact", contact.ContactId, contact, current, ok)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	for _, t := range d.Tests {
+		current, ok := currentTests[t.TestId]
+		t.CreatedAt = current.CreatedAt
+		change, err := diffObject("test", t.TestId, t, current, ok)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	testContacts, err := dao.GetAllTestContacts(db)
+	if err != nil {
+		return nil, err
+	}
+	currentTestContacts := map[string]pingr.TestContact{}
+	for _, tc := range testContacts {
+		currentTestContacts[tc.TestId+"/"+tc.ContactId] = tc
+	}
+	for _, tc := range d.TestContacts {
+		if _, ok := currentContacts[tc.ContactId]; !ok && !declaresContact(d, tc.ContactId) {
+			return nil, errors.New("test contact " + tc.TestId + "/" + tc.ContactId + ": no such contact")
+		}
+		current, ok := currentTestContacts[tc.TestId+"/"+tc.ContactId]
+		change, err := diffObject("test_contact", tc.TestId+"/"+tc.ContactId, tc, current, ok)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, change)
+	}
+
+	return changes, nil
+}
+
+// diffObject compares the fields of an imported object to the current one, as marshalled to JSON
+func diffObject(objectType string, objectId string, imported interface{}, current interface{}, exists bool) (Change, error) {
+	change := Change{ObjectType: objectType, ObjectId: objectId, Action: "create"}
+	if !exists {
+		return change, nil
+	}
+
+	var a, b map[string]json.RawMessage
+	for _, v := range []struct {
+		obj interface{}
+		m   *map[string]json.RawMessage
+	}{{imported, &a}, {current, &b}} {
+		data, err := json.Marshal(v.obj)
+		if err != nil {
+			return change, err
+		}
+		err = json.Unmarshal(data, v.m)
+		if err != nil {
+			return change, err
+		}
+	}
+	for field, value := range a {
+		if !sameJSON(value, b[field]) {
+			change.Fields = append(change.Fields, field)
+		}
+	}
+
+	sort.Strings(change.Fields)
+
+	change.Action = "unchanged"
+	if len(change.Fields) > 0 {
+		change.Action = "conflict"
+	}
+	return change, nil
+}
+
+// apply makes the changes, contacts first as they are referred to by test contacts
+func apply(d gitops.Declared, changes []Change, currentTests map[string]pingr.GenericTest, db dao.Ext) error {
+	actions := map[string]string{}
+	for _, change := range changes {
+		actions[change.ObjectType+":"+change.ObjectId] = change.Action
+	}
+
+	for _, contact := range d.Contacts {
+		var err error
+		switch actions["contact:"+contact.ContactId] {
+		case "create":
+			err = dao.PostContact(contact, db)
+		case "update":
+			err = dao.PutContact(contact, db)
+		}
+		if err != nil {
+			return errors.New("contact " + contact.ContactId + ": " + err.Error())
+		}
+	}
+
+	for _, t := range d.Tests {
+		var err error
+		switch actions["test:"+t.TestId] {
+		case "create":
+			t.CreatedAt = time.Now()
+			err = t.MaskSensitiveInfo(pingr.POST, nil)
+			if err == nil {
+				err = dao.PostTest(t, db)
+			}
+		case "update":
+			t.CreatedAt = currentTests[t.TestId].CreatedAt
+			err = t.MaskSensitiveInfo(pingr.POST, nil)
+			if err == nil {
+				err = dao.PutTest(t, db)
+			}
+		}
+		if err != nil {
+			return errors.New("test " + t.TestId + ": " + err.Error())
+		}
+	}
+
+	for _, tc := range d.TestContacts {
+		switch actions["test_contact:"+tc.TestId+"/"+tc.ContactId] {
+		case "create", "update":
+			err := dao.PutTestContact(tc, db)
+			if err != nil {
+				return errors.New("test contact " + tc.TestId + "/" + tc.ContactId + ": " + err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func declaresContact(d gitops.Declared, contactId string) bool {
+	for _, contact := range d.Contacts {
+		if contact.ContactId == contactId {
+			return true
+		}
+	}
+	return false
+}
+
+func sameJSON(a json.RawMessage, b json.RawMessage) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return string(a) == string(b)
+	}
+	ax, _ := json.Marshal(x)
+	by, _ := json.Marshal(y)
+	return string(ax) == string(by)
+}
@@ -0,0 +1,245 @@
+package users
+
+import (
+	"database/sql"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/labstack/echo/v4"
+	"pingr"
+	"pingr/internal/auth"
+	"pingr/internal/config"
+	"pingr/internal/dao"
+	"pingr/internal/sec"
+	"time"
+)
+
+// tokenRequest is the body of a new API token, expiring at ExpiresAt, or never if it is not set
+type tokenRequest struct {
+	TokenName string     `json:"token_name"`
+	Scope     string     `json:"scope"`   // ScopeAll if empty
+	UserId    string     `json:"user_id"` // The requesting user if empty, only admins create tokens of other users
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// Init adds the endpoints managing users, only allowed for admins, and API tokens, where users manage their own
+// and admins those of all users
+func Init(users *echo.Group, tokens *echo.Group) {
+	admin := auth.Allow(pingr.RoleAdmin, pingr.RoleAdmin)
+	anyone := auth.Allow(pingr.RoleViewer, pingr.RoleViewer)
+
+	// Who the request is authenticated as
+	users.GET("/me", func(c echo.Context) error {
+		return c.JSON(200, auth.Get(c))
+	}, anyone)
+
+	users.GET("", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		users, err := dao.GetUsers(db)
+		if err != nil {
+			return c.String(500, "could not get users: "+err.Error())
+		}
+		return c.JSON(200, users)
+	}, admin)
+
+	users.GET("/:userId", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		user, err := dao.GetUser(c.Param("userId"), db)
+		if err != nil {
+			return c.String(400, "Not a valid userId, "+err.Error())
+		}
+		return c.JSON(200, user)
+	}, admin)
+
+	users.POST("", func(c echo.Context) error {
+		var user pingr.User
+		if err := c.Bind(&user); err != nil {
+			return c.String(400, "Could not parse body as user: "+err.Error())
+		}
+		user.UserId = uuid.New().String()
+		user.CreatedAt = time.Now()
+		if user.Password == "" {
+			return c.String(400, "invalid input: missing password")
+		}
+		if user.Username == config.Get().BasicAuthUser {
+			return c.String(400, "invalid input: the username is taken by BASIC_AUTH_USER")
+		}
+		var err error
+		user.PasswordHash, err = sec.HashPassword(user.Password)
+		if err != nil {
+			return c.String(500, "could not hash password: "+err.Error())
+		}
+		user.Password = ""
+		if !user.Validate() {
+			return c.String(400, "invalid input: User")
+		}
+
+		db := c.Get("DB").(*sqlx.DB)
+		err = dao.PostUser(user, db)
+		if err != nil {
+			return c.String(500, "could not add user to db: "+err.Error())
+		}
+		return c.JSON(200, user)
+	}, admin)
+
+	// Update the username or role of a user, and the password if set
+	users.PUT("/:userId", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		current, err := dao.GetUser(c.Param("userId"), db)
+		if err != nil {
+			return c.String(400, "Not a valid userId, "+err.Error())
+		}
+
+		var user pingr.User
+		if err := c.Bind(&user); err != nil {
+			return c.String(400, "Could not parse body as user: "+err.Error())
+		}
+		user.UserId = current.UserId
+		user.CreatedAt = current.CreatedAt
+		user.PasswordHash = current.PasswordHash
+		if user.Password != "" {
+			user.PasswordHash, err = sec.HashPassword(user.Password)
+			if err != nil {
+				return c.String(500, "could not hash password: "+err.Error())
+			}
+			user.Password = ""
+		}
+		if user.Username == config.Get().BasicAuthUser {
+			return c.String(400, "invalid input: the username is taken by BASIC_AUTH_USER")
+		}
+		if !user.Validate() {
+			return c.String(400, "invalid input: User")
+		}
+
+		err = dao.PutUser(user, db)
+		if err != nil {
+			return c.String(500, "could not update user: "+err.Error())
+		}
+		return c.JSON(200, user)
+	}, admin)
+
+	users.DELETE("/:userId", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		userId := c.Param("userId")
+
+		_, err := dao.GetUser(userId, db)
+		if err != nil {
+			return c.String(400, "Not a valid userId, "+err.Error())
+		}
+		if userId == auth.Get(c).UserId {
+			return c.String(400, "invalid input: can not delete yourself")
+		}
+
+		err = dao.DeleteUser(userId, db)
+		if err != nil {
+			return c.String(500, "could not delete user: "+err.Error())
+		}
+		return c.String(200, "user deleted")
+	}, admin)
+
+	tokens.Use(anyone)
+
+	// The tokens of the requesting user, or with ?user_id= of another user for admins, or of all users for
+	// admins with ?user_id=*
+	tokens.GET("", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		p := auth.Get(c)
+
+		userId := c.QueryParam("user_id")
+		switch {
+		case userId == "":
+			userId = p.UserId
+			if userId == "" {
+				return c.JSON(200, []pingr.APIToken{}) // BASIC_AUTH_USER and sessions have no user, nor tokens
+			}
+		case !p.HasRole(pingr.RoleAdmin) && userId != p.UserId:
+			return c.String(403, "forbidden: requires the role admin")
+		case userId == "*":
+			userId = ""
+		}
+
+		tokens, err := dao.GetAPITokens(userId, db)
+		if err != nil {
+			return c.String(500, "could not get tokens: "+err.Error())
+		}
+		return c.JSON(200, tokens)
+	})
+
+	// Create a token, it is only returned once
+	tokens.POST("", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		p := auth.Get(c)
+
+		var req tokenRequest
+		if err := c.Bind(&req); err != nil {
+			return c.String(400, "Could not parse body as token: "+err.Error())
+		}
+		if req.UserId == "" {
+			req.UserId = p.UserId
+		}
+		if req.UserId == "" {
+			return c.String(400, "invalid input: tokens belong to users, set user_id")
+		}
+		if req.UserId != p.UserId && !p.HasRole(pingr.RoleAdmin) {
+			return c.String(403, "forbidden: requires the role admin")
+		}
+		_, err := dao.GetUser(req.UserId, db)
+		if err == sql.ErrNoRows {
+			return c.String(400, "invalid input: no such user")
+		}
+		if err != nil {
+			return c.String(500, "could not get user: "+err.Error())
+		}
+
+		token := pingr.APIToken{
+			TokenId:   uuid.New().String(),
+			TokenName: req.TokenName,
+			UserId:    req.UserId,
+			Scope:     req.Scope,
+			CreatedAt: time.Now(),
+		}
+		if token.Scope == "" {
+			token.Scope = pingr.ScopeAll
+		}
+		if req.ExpiresAt != nil {
+			if !req.ExpiresAt.After(token.CreatedAt) {
+				return c.String(400, "invalid input: expires_at has passed")
+			}
+			token.ExpiresAt = sql.NullTime{Time: *req.ExpiresAt, Valid: true}
+		}
+		if !token.Validate() {
+			return c.String(400, "invalid input: Token")
+		}
+
+		secret, err := sec.NewToken()
+		if err != nil {
+			return c.String(500, "could not generate token: "+err.Error())
+		}
+		token.TokenHash = sec.HashToken(secret)
+
+		err = dao.PostAPIToken(token, db)
+		if err != nil {
+			return c.String(500, "could not add token to db: "+err.Error())
+		}
+		return c.JSON(200, map[string]interface{}{"api_token": token, "token": secret})
+	})
+
+	tokens.DELETE("/:tokenId", func(c echo.Context) error {
+		db := c.Get("DB").(*sqlx.DB)
+		p := auth.Get(c)
+		tokenId := c.Param("tokenId")
+
+		token, err := dao.GetAPIToken(tokenId, db)
+		if err != nil {
+			return c.String(400, "Not a valid tokenId, "+err.Error())
+		}
+		if token.UserId != p.UserId && !p.HasRole(pingr.RoleAdmin) {
+			return c.String(403, "forbidden: requires the role admin")
+		}
+
+		err = dao.DeleteAPIToken(tokenId, db)
+		if err != nil {
+			return c.String(500, "could not delete token: "+err.Error())
+		}
+		return c.String(200, "token deleted")
+	})
+}
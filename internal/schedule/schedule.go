@@ -0,0 +1,37 @@
+package schedule
+
+import (
+	"errors"
+	"github.com/robfig/cron/v3"
+	"time"
+)
+
+// Schedule is a standard cron expression, e.g. "0 2 * * 1-5", evaluated in a time zone
+type Schedule struct {
+	cron     cron.Schedule
+	location *time.Location
+}
+
+func Parse(expr string, timeZone string) (Schedule, error) {
+	var s Schedule
+	if expr == "" {
+		return s, errors.New("empty cron expression")
+	}
+
+	var err error
+	s.location, err = time.LoadLocation(timeZone) // "" -> UTC
+	if err != nil {
+		return s, err
+	}
+
+	s.cron, err = cron.ParseStandard(expr)
+	if err != nil {
+		return s, err
+	}
+	return s, nil
+}
+
+// Next returns the first scheduled time after t
+func (s Schedule) Next(t time.Time) time.Time {
+	return s.cron.Next(t.In(s.location))
+}
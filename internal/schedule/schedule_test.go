@@ -0,0 +1,79 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	s, err := Parse("0 2 * * 1-5", "Europe/Stockholm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Friday 2020-07-10 12:00 UTC -> Monday 02:00 CEST
+	next := s.Next(time.Date(2020, 7, 10, 12, 0, 0, 0, time.UTC))
+	exp := time.Date(2020, 7, 13, 0, 0, 0, 0, time.UTC)
+	if !next.Equal(exp) {
+		t.Logf("expected %v, got %v", exp, next)
+		t.Fail()
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, c := range []struct {
+		expr     string
+		timeZone string
+	}{
+		{"", ""},
+		{"* * *", ""},
+		{"0 2 * * *", "Not/AZone"},
+	} {
+		if _, err := Parse(c.expr, c.timeZone); err == nil {
+			t.Logf("expected %q in %q to be invalid", c.expr, c.timeZone)
+			t.Fail()
+		}
+	}
+}
+
+func TestWindow(t *testing.T) {
+	w, err := ParseWindow("07:00-19:00", "mon-fri", "Europe/Stockholm")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Friday 2020-07-10 12:00 UTC is 14:00 CEST
+	if !w.Contains(time.Date(2020, 7, 10, 12, 0, 0, 0, time.UTC)) {
+		t.Log("expected friday afternoon to be active")
+		t.Fail()
+	}
+
+	// Friday 2020-07-10 18:00 UTC -> Monday 07:00 CEST
+	next := w.Next(time.Date(2020, 7, 10, 18, 0, 0, 0, time.UTC))
+	exp := time.Date(2020, 7, 13, 5, 0, 0, 0, time.UTC)
+	if !next.Equal(exp) {
+		t.Logf("expected %v, got %v", exp, next)
+		t.Fail()
+	}
+
+	// Over midnight, belongs to the day it starts
+	w, err = ParseWindow("22:00-06:00", "fri", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Contains(time.Date(2020, 7, 11, 3, 0, 0, 0, time.UTC)) {
+		t.Log("expected saturday night to be active")
+		t.Fail()
+	}
+	if w.Contains(time.Date(2020, 7, 10, 3, 0, 0, 0, time.UTC)) {
+		t.Log("expected friday night to be inactive")
+		t.Fail()
+	}
+
+	for _, c := range [][2]string{{"07:00", ""}, {"07:00-07:00", ""}, {"25:00-26:00", ""}, {"", "mon-"}, {"", "funday"}} {
+		if _, err := ParseWindow(c[0], c[1], ""); err == nil {
+			t.Logf("expected %q %q to be invalid", c[0], c[1])
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var weekdays = map[string]int{
+	"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+}
+
+// Window is a recurring active period, e.g. 07:00-19:00 on mon-fri, evaluated in a time zone.
+// A window ending before it starts, e.g. 22:00-06:00, runs over midnight and belongs to the day it starts.
+type Window struct {
+	start    int // minutes into the day
+	end      int
+	days     [7]bool
+	location *time.Location
+}
+
+// ParseWindow parses active hours, "HH:MM-HH:MM", and active days, e.g. "mon-fri,sun" or "1-5,0".
+// Empty hours or days means the whole day or every day.
+func ParseWindow(hours string, days string, timeZone string) (Window, error) {
+	var w Window
+	var err error
+	w.location, err = time.LoadLocation(timeZone) // "" -> UTC
+	if err != nil {
+		return w, err
+	}
+
+	w.start, w.end = 0, 24*60
+	if hours != "" {
+		parts := strings.Split(hours, "-")
+		if len(parts) != 2 {
+			return w, fmt.Errorf("invalid active hours: %s", hours)
+		}
+		w.start, err = parseClock(parts[0])
+		if err != nil {
+			return w, err
+		}
+		w.end, err = parseClock(parts[1])
+		if err != nil {
+			return w, err
+		}
+		if w.start == w.end {
+			return w, fmt.Errorf("invalid active hours, empty window: %s", hours)
+		}
+	}
+
+	if days == "" {
+		for i := range w.days {
+			w.days[i] = true
+		}
+		return w, nil
+	}
+	for _, item := range strings.Split(days, ",") {
+		bounds := strings.Split(strings.TrimSpace(item), "-")
+		if len(bounds) > 2 {
+			return w, fmt.Errorf("invalid active days: %s", days)
+		}
+		from, err := parseWeekday(bounds[0])
+		if err != nil {
+			return w, err
+		}
+		to := from
+		if len(bounds) == 2 {
+			to, err = parseWeekday(bounds[1])
+			if err != nil {
+				return w, err
+			}
+		}
+		for d := from; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == to {
+				break
+			}
+		}
+	}
+	return w, nil
+}
+
+// Contains reports whether t is within the window
+func (w Window) Contains(t time.Time) bool {
+	t = t.In(w.location)
+	minute := t.Hour()*60 + t.Minute()
+	day := int(t.Weekday())
+
+	if w.start < w.end {
+		return w.days[day] && w.start <= minute && minute < w.end
+	}
+	if minute >= w.start {
+		return w.days[day]
+	}
+	if minute < w.end {
+		return w.days[(day+6)%7]
+	}
+	return false
+}
+
+// Next returns t if it is within the window, otherwise the start of the next window
+func (w Window) Next(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	local := t.In(w.location)
+	for i := 0; i <= 7; i++ {
+		start := time.Date(local.Year(), local.Month(), local.Day()+i, w.start/60, w.start%60, 0, 0, w.location)
+		if start.After(t) && w.days[start.Weekday()] {
+			return start
+		}
+	}
+	return t
+}
+
+func parseClock(s string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(s), ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+	hour, err := strconv.Atoi(parts[0])
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+	minute, err := strconv.Atoi(parts[1])
+	if err != nil || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, fmt.Errorf("invalid time of day: %s", s)
+	}
+	return hour*60 + minute, nil
+}
+
+func parseWeekday(s string) (int, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if d, ok := weekdays[s]; ok {
+		return d, nil
+	}
+	d, err := strconv.Atoi(s)
+	if err != nil || d < 0 || d > 7 {
+		return 0, fmt.Errorf("invalid weekday: %s", s)
+	}
+	return d % 7, nil // 7 is sunday as well, as in cron
+}
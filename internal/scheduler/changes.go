@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"database/sql"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"pingr/internal/dao"
+	"pingr/internal/ha"
+	"time"
+)
+
+// Changes are kept for a day, long enough for any instance to have picked them up
+const changeRetention = 24 * time.Hour
+
+// changeListener follows the changes of the tests, starting, restarting or stopping the changed tests. It is woken
+// up through the bus by changes made through this instance, and polls for changes made through other instances
+func (s *Scheduler) changeListener() {
+	pruned := time.Now()
+	for {
+		_, _ = s.buz.Next("changes", ChangeListenerInterval) // Woken up by a change, or timed out
+		if s.ctx.Err() != nil {
+			return
+		}
+		if !ha.IsLeader() {
+			continue
+		}
+		s.applyChanges()
+
+		if time.Since(pruned) > time.Hour {
+			pruned = time.Now()
+			err := dao.DeleteTestChangesBefore(time.Now().Add(-changeRetention), s.db)
+			if err != nil {
+				log.Error(fmt.Sprintf("could not prune test changes: %v", err))
+			}
+		}
+	}
+}
+
+func (s *Scheduler) applyChanges() {
+	s.muTests.RLock()
+	after := s.lastChange
+	s.muTests.RUnlock()
+
+	changes, err := dao.GetTestChanges(after, s.db)
+	if err != nil {
+		log.Error(fmt.Sprintf("could not get test changes: %v", err))
+		return
+	}
+
+	// A test changed several times, e.g. by a bulk edit, is only reloaded once
+	seen := map[string]bool{}
+	for _, change := range changes {
+		if !seen[change.TestId] {
+			seen[change.TestId] = true
+			err = s.reloadTest(change.TestId)
+			if err != nil {
+				log.Error(fmt.Sprintf("could not reload test: %v", err))
+				return // Retried on the next change or poll
+			}
+		}
+
+		s.muTests.Lock()
+		if change.ChangeId > s.lastChange {
+			s.lastChange = change.ChangeId
+		}
+		s.muTests.Unlock()
+	}
+}
+
+// reloadTest starts, or restarts, the test from the database, or stops it if it has been paused or deleted
+func (s *Scheduler) reloadTest(testId string) error {
+	test, err := dao.GetRawTest(testId, s.db)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	s.muTests.RLock()
+	_, running := s.tests[testId]
+	s.muTests.RUnlock()
+
+	switch {
+	case err == sql.ErrNoRows:
+		return s.closeTest(testId)
+	case !test.Active:
+		if !running {
+			return nil
+		}
+		err = s.closeTest(testId)
+		if err != nil {
+			return err
+		}
+		addTestLog(testId, Paused, 0, nil, s.db)
+	default:
+		s.startTest(test)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package scheduler
+
+import (
+	"database/sql"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"pingr"
+	"pingr/internal/dao"
+	"pingr/internal/notifications"
+	"sort"
+	"time"
+)
+
+const (
+	// Response times used for the rolling p95, and the least needed to compare against it
+	p95Samples    = 100
+	p95MinSamples = 20
+)
+
+// degraded returns an error describing why a successful run is considered degraded, nil if it is not
+func (s *Scheduler) degraded(test pingr.BaseTest, rt time.Duration) error {
+	threshold := test.DegradedThreshold * time.Millisecond
+	if threshold > 0 && rt > threshold {
+		return fmt.Errorf("response time %s above threshold %s", rt.Round(time.Millisecond), threshold)
+	}
+
+	if test.DegradedFactor == 0 {
+		return nil
+	}
+	rts, err := dao.GetTestResponseTimes(test.TestId, p95Samples, s.db)
+	if err != nil {
+		log.Error(fmt.Sprintf("could not get response times: %v", err))
+		return nil
+	}
+	if len(rts) < p95MinSamples {
+		return nil
+	}
+	p95 := percentile(rts, 0.95)
+	limit := time.Duration(float64(p95) * test.DegradedFactor)
+	if rt > limit {
+		return fmt.Errorf("response time %s above %.1f times p95 %s", rt.Round(time.Millisecond), test.DegradedFactor, p95.Round(time.Millisecond))
+	}
+	return nil
+}
+
+// updateDegraded moves the test in to, or out of, the degraded state after a successful run, notifying all contacts
+// of the test once on each change if enabled. The state is kept through failed runs in between
+func (s *Scheduler) updateDegraded(test pingr.BaseTest, status uint, rt time.Duration, msg error) {
+	_, err := dao.GetDegradation(test.TestId, s.db)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(fmt.Sprintf("could not get degraded state: %v", err))
+		return
+	}
+	wasDegraded := err == nil
+
+	switch {
+	case status == Degraded && !wasDegraded:
+		err = dao.PostDegradation(pingr.Degradation{
+			TestId:    test.TestId,
+			Message:   msg.Error(),
+			StartedAt: time.Now(),
+		}, s.db)
+	case status != Degraded && wasDegraded:
+		err = dao.DeleteDegradation(test.TestId, s.db)
+	default:
+		return
+	}
+	if err != nil {
+		log.Error(fmt.Sprintf("could not update degraded state: %v", err))
+		return
+	}
+	if !test.DegradedNotify {
+		return
+	}
+
+	if status != Degraded {
+		msg = fmt.Errorf("test no longer degraded, response time %s", rt.Round(time.Millisecond))
+	}
+
+	contacts, err := dao.GetTestContactsType(test.TestId, s.db)
+	if err != nil {
+		log.Error(fmt.Sprintf("could not get test contacts: %v", err))
+		return
+	}
+	for _, contact := range contacts {
+		switch contact.ContactType {
+		case "smtp":
+			err = notifications.SendDegradedEmail([]string{contact.ContactUrl}, test, status == Degraded, rt, s.db)
+		case "http":
+			err = notifications.PostHook([]string{contact.ContactUrl}, test, msg, status)
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("could not send notification: %v", err))
+		}
+	}
+}
+
+func percentile(rts []time.Duration, p float64) time.Duration {
+	sorted := append([]time.Duration{}, rts...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"database/sql"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"pingr"
+	"pingr/internal/config"
+	"pingr/internal/dao"
+	"pingr/internal/notifications"
+	"time"
+)
+
+// stateChange returns the percentage of state changes between the results, newest first, where the most recent
+// changes weigh the most, 1.2, and the oldest the least, 0.8, as in Nagios
+func stateChange(results []uint) float64 {
+	if len(results) < 2 {
+		return 0
+	}
+	var sum float64
+	changes := len(results) - 1
+	for i := 0; i < changes; i++ {
+		if failed(results[i]) == failed(results[i+1]) {
+			continue
+		}
+		weight := 1.2
+		if changes > 1 {
+			weight = 1.2 - 0.4*float64(i)/float64(changes-1)
+		}
+		sum += weight
+	}
+	return sum / float64(changes) * 100
+}
+
+// updateFlapping moves the test in to, or out of, the flapping state, notifying all of its contacts once on each change
+func (s *Scheduler) updateFlapping(test pingr.BaseTest, testErr error) {
+	cfg := config.Get()
+	if cfg.FlapWindow == 0 {
+		return
+	}
+
+	results, err := dao.GetTestResults(test.TestId, cfg.FlapWindow, s.db)
+	if err != nil {
+		log.Error(fmt.Sprintf("could not get test results: %v", err))
+		return
+	}
+	if len(results) < cfg.FlapWindow {
+		return // Not enough history
+	}
+	change := stateChange(results)
+
+	_, err = dao.GetFlapping(test.TestId, s.db)
+	if err != nil && err != sql.ErrNoRows {
+		log.Error(fmt.Sprintf("could not get flapping state: %v", err))
+		return
+	}
+	flapping := err == nil
+
+	switch {
+	case !flapping && change >= cfg.FlapHighThreshold:
+		err = dao.PostFlapping(pingr.Flapping{
+			TestId:      test.TestId,
+			StateChange: change,
+			StartedAt:   time.Now(),
+		}, s.db)
+		if err != nil {
+			log.Error(fmt.Sprintf("could not post flapping state: %v", err))
+			return
+		}
+		flapErr := fmt.Errorf("test is flapping, %.0f%% state change", change)
+		addTestLog(test.TestId, Flapping, 0, flapErr, s.db)
+		s.notifyFlapping(test, true, change, Flapping, flapErr)
+	case flapping && change < cfg.FlapLowThreshold:
+		err = dao.DeleteFlapping(test.TestId, s.db)
+		if err != nil {
+			log.Error(fmt.Sprintf("could not delete flapping state: %v", err))
+			return
+		}
+		status := Successful
+		if testErr != nil {
+			status = Error
+		}
+		s.notifyFlapping(test, false, change, status, fmt.Errorf("test stopped flapping, %.0f%% state change", change))
+	}
+}
+
+func failed(status uint) bool {
+	return status == Error || status == TimedOut
+}
+
+func (s *Scheduler) isFlapping(testId string) bool {
+	_, err := dao.GetFlapping(testId, s.db)
+	return err == nil
+}
+
+func (s *Scheduler) notifyFlapping(test pingr.BaseTest, flapping bool, change float64, status uint, msg error) {
+	contacts, err := dao.GetTestContactsType(test.TestId, s.db)
+	if err != nil {
+		log.Error(fmt.Sprintf("could not get test contacts: %v", err))
+		return
+	}
+	for _, contact := range contacts {
+		switch contact.ContactType {
+		case "smtp":
+			err = notifications.SendFlappingEmail([]string{contact.ContactUrl}, test, flapping, change, s.db)
+		case "http":
+			err = notifications.PostHook([]string{contact.ContactUrl}, test, msg, status)
+		}
+		if err != nil {
+			log.Error(fmt.Sprintf("could not send notification: %v", err))
+		}
+	}
+}
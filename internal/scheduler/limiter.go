@@ -0,0 +1,121 @@
+package scheduler
+
+import (
+	"context"
+	"net/url"
+	"pingr"
+	"pingr/internal/metrics"
+	"sync"
+	"time"
+)
+
+// limiter bounds the number of tests running at once, in total and against a single host.
+// A limit of 0 means unlimited
+type limiter struct {
+	global  chan struct{}
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	slots chan struct{}
+	users int // workers holding or waiting for a slot, the entry is removed when it reaches 0
+}
+
+func newLimiter(global int, perHost int) *limiter {
+	l := &limiter{
+		perHost: perHost,
+		hosts:   make(map[string]*hostSlots),
+	}
+	if global > 0 {
+		l.global = make(chan struct{}, global)
+	}
+	return l
+}
+
+// acquire blocks until the test may run, returning a func releasing its slots. The host slot is taken
+// before the global one so that tests queued behind a busy host doesn't hold back tests against other hosts
+func (l *limiter) acquire(ctx context.Context, host string) (func(), error) {
+	metrics.SchedulerQueueInc()
+	defer metrics.SchedulerQueueDec()
+
+	queued := time.Now()
+	releaseHost, err := l.acquireHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if l.global != nil {
+		select {
+		case l.global <- struct{}{}:
+		case <-ctx.Done():
+			releaseHost()
+			return nil, ctx.Err()
+		}
+	}
+	metrics.SchedulerLagObserve(time.Since(queued).Seconds())
+	metrics.SchedulerRunningInc()
+
+	return func() {
+		metrics.SchedulerRunningDec()
+		if l.global != nil {
+			<-l.global
+		}
+		releaseHost()
+	}, nil
+}
+
+func (l *limiter) acquireHost(ctx context.Context, host string) (func(), error) {
+	if l.perHost <= 0 || host == "" {
+		return func() {}, nil
+	}
+
+	l.mu.Lock()
+	h, ok := l.hosts[host]
+	if !ok {
+		h = &hostSlots{slots: make(chan struct{}, l.perHost)}
+		l.hosts[host] = h
+	}
+	h.users++
+	l.mu.Unlock()
+
+	done := func() {
+		l.mu.Lock()
+		h.users--
+		if h.users == 0 {
+			delete(l.hosts, host)
+		}
+		l.mu.Unlock()
+	}
+
+	select {
+	case h.slots <- struct{}{}:
+	case <-ctx.Done():
+		done()
+		return nil, ctx.Err()
+	}
+	return func() {
+		<-h.slots
+		done()
+	}, nil
+}
+
+// limited reports whether runs of the test take a slot. Push tests only wait for incoming data, often for a long
+// time, and are not limited
+func limited(test pingr.BaseTest) bool {
+	switch test.TestType {
+	case "HTTPPush", "PrometheusPush", "JSONPush", "LinePush":
+		return false
+	}
+	return true
+}
+
+// targetHost returns the host the test is run against
+func targetHost(test pingr.BaseTest) string {
+	u, err := url.Parse(test.Url)
+	if err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return test.Url
+}
@@ -0,0 +1,87 @@
+package scheduler
+
+import (
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"pingr"
+	"pingr/internal/dao"
+	"strings"
+	"time"
+)
+
+// testLocations returns the locations the test is assigned to, empty if it is only run locally
+func (s *Scheduler) testLocations(testId string) []string {
+	locations, err := dao.GetTestLocations(testId, s.db)
+	if err != nil {
+		log.Error(fmt.Sprintf("could not get test locations: %v", err))
+		return nil
+	}
+	return locations
+}
+
+func (s *Scheduler) runsLocally(testId string) bool {
+	locations := s.testLocations(testId)
+	if len(locations) == 0 {
+		return true
+	}
+	for _, location := range locations {
+		if location == pingr.LocalLocation {
+			return true
+		}
+	}
+	return false
+}
+
+// quorumFailure returns an error describing the failing locations if at least the quorum of them are failing,
+// judged by the latest result of each location. Results older than two intervals, e.g. from an agent that is
+// down, are not counted
+func (s *Scheduler) quorumFailure(test pingr.BaseTest, locations []string) error {
+	quorum := int(test.LocationQuorum)
+	if quorum == 0 {
+		quorum = 1
+	}
+	if quorum > len(locations) {
+		quorum = len(locations)
+	}
+
+	stale := test.StaleAfter()
+	var failing []string
+	for _, location := range locations {
+		l, err := dao.GetLatestLocationResult(test.TestId, location, s.db)
+		if err != nil {
+			continue // No results yet
+		}
+		if time.Since(l.CreatedAt) > stale {
+			continue
+		}
+		if failed(l.StatusId) {
+			failing = append(failing, fmt.Sprintf("%s: %s", location, l.Message))
+		}
+	}
+	if len(failing) < quorum {
+		return nil
+	}
+	return fmt.Errorf("failing from %d of %d locations, %s", len(failing), len(locations), strings.Join(failing, "; "))
+}
+
+// reportAgentResult reports the result of a test run by an agent, as if it was run locally
+func (s *Scheduler) reportAgentResult(r pingr.AgentResult) {
+	s.muTests.RLock()
+	test, ok := s.tests[r.TestId]
+	s.muTests.RUnlock()
+	if !ok {
+		return // Paused or deleted
+	}
+
+	res := result{
+		rt:       r.ResponseTime,
+		timedOut: r.TimedOut,
+		location: r.Location,
+		at:       r.CreatedAt,
+	}
+	if r.Error != "" {
+		res.err = errors.New(r.Error)
+	}
+	s.reportTestResponse(test.BaseTest, res)
+}
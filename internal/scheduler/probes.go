@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	log "github.com/sirupsen/logrus"
+	"pingr/internal/metrics"
+	"sync"
+	"time"
+)
+
+// Tests with this many probes still running, i.e. abandoned by the watchdog and not yet returned, are not probed
+// again until one of them returns
+const MaxHungProbes = 3
+
+// probes keeps count of the probes running for each test, including those abandoned by the watchdog
+type probes struct {
+	mu      sync.Mutex
+	running map[string]int
+}
+
+func newProbes() *probes {
+	return &probes{running: make(map[string]int)}
+}
+
+// run probes the test within the deadline, the probe is abandoned by a watchdog if it has not returned once the grace
+// has passed as well. release is called once the probe returns, so that abandoned probes keep their slots
+func (p *probes) run(ctx context.Context, testId string, deadline time.Duration, grace time.Duration, release func(),
+	probe func(ctx context.Context) (time.Duration, string, error)) result {
+
+	p.mu.Lock()
+	if p.running[testId] >= MaxHungProbes {
+		p.mu.Unlock()
+		release()
+		return result{err: errors.New("earlier probes of the test are still hung")}
+	}
+	p.running[testId]++
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, deadline)
+	done := make(chan result, 1)
+	go func() {
+		defer p.done(testId)
+		defer release()
+		defer cancel()
+
+		var res result
+		res.rt, res.message, res.err = probe(ctx)
+		res.timedOut = ctx.Err() == context.DeadlineExceeded
+		done <- res
+	}()
+
+	start := time.Now()
+	watchdog := time.NewTimer(deadline + grace)
+	defer watchdog.Stop()
+
+	select {
+	case res := <-done:
+		return res
+	case <-watchdog.C:
+		metrics.HungProbesInc()
+		log.Warn(fmt.Sprintf("TestID: %s, probe did not return within its deadline", testId))
+		return result{
+			rt:       time.Since(start),
+			err:      errors.New("test did not return within its deadline"),
+			timedOut: true,
+			hung:     true,
+		}
+	}
+}
+
+func (p *probes) done(testId string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.running[testId]--
+	if p.running[testId] == 0 {
+		delete(p.running, testId)
+	}
+}
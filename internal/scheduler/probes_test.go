@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestProbesWatchdog(t *testing.T) {
+	p := newProbes()
+	unblock := make(chan struct{})
+	released := make(chan struct{}, MaxHungProbes)
+	hanging := func(ctx context.Context) (time.Duration, string, error) {
+		<-unblock // Ignores the deadline
+		return 0, "", nil
+	}
+	returning := func(ctx context.Context) (time.Duration, string, error) {
+		return time.Millisecond, "", nil
+	}
+
+	for i := 0; i < MaxHungProbes; i++ {
+		res := p.run(context.Background(), "t1", 10*time.Millisecond, 10*time.Millisecond, func() {
+			released <- struct{}{}
+		}, hanging)
+		if !res.hung || !res.timedOut || res.err == nil {
+			t.Fatalf("expected probe %d to be abandoned as hung, got %+v", i, res)
+		}
+	}
+	select {
+	case <-released:
+		t.Fatal("expected the slots of hung probes to be held until they return")
+	default:
+	}
+
+	// Not probed again while too many probes are hung, but other tests are
+	probed := false
+	probing := func(ctx context.Context) (time.Duration, string, error) {
+		probed = true
+		return 0, "", nil
+	}
+	res := p.run(context.Background(), "t1", time.Second, time.Second, func() {}, probing)
+	if probed || res.err == nil || res.hung {
+		t.Fatalf("expected the test not to be probed with %d hung probes, got %+v", MaxHungProbes, res)
+	}
+	res = p.run(context.Background(), "t2", time.Second, time.Second, func() {}, returning)
+	if res.err != nil {
+		t.Fatalf("expected another test to be probed, got %+v", res)
+	}
+
+	close(unblock)
+	for i := 0; i < MaxHungProbes; i++ {
+		select {
+		case <-released:
+		case <-time.After(time.Second):
+			t.Fatal("expected the slots to be released once the hung probes return")
+		}
+	}
+
+	// The hung probes have returned, which they do just after releasing their slots
+	deadline := time.Now().Add(time.Second)
+	for {
+		res = p.run(context.Background(), "t1", time.Second, time.Second, func() {}, returning)
+		if res.err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the test to be probed again, got %+v", res)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -1,9 +1,9 @@
 package scheduler
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx"
 	log "github.com/sirupsen/logrus"
@@ -14,15 +14,22 @@ import (
 	"pingr/internal/bus"
 	"pingr/internal/config"
 	"pingr/internal/dao"
+	"pingr/internal/ha"
 	"pingr/internal/notifications"
-	"reflect"
 	"sync"
 	"syscall"
 	"time"
 )
 
 const (
-	DataBaseListenerInterval = 10 * time.Minute
+	// Changes made through this instance are picked up right away, and through other instances within the interval
+	ChangeListenerInterval = 5 * time.Second
+
+	// Probes not returning within their deadline plus the grace are considered hung and abandoned by the watchdog
+	WatchdogGrace = 10 * time.Second
+
+	// Pushes received this long before a scheduled time, or the start of an active window, count for it
+	EarlyPush = time.Minute
 
 	// Change in DB as well
 	Successful  uint = 1
@@ -30,6 +37,11 @@ const (
 	TimedOut    uint = 3
 	Initialized uint = 5
 	Paused      uint = 6
+	Retried     uint = 7
+	Inactive    uint = 8
+	Maintenance uint = 9
+	Flapping    uint = 10
+	Degraded    uint = 11
 )
 
 type Scheduler struct {
@@ -38,35 +50,118 @@ type Scheduler struct {
 	muTests sync.RWMutex
 
 	tests      map[string]pingr.GenericTest
-	closeChans map[string]chan struct{}
+	lastChange uint64 // The latest change of the tests that has been picked up, guarded by muTests
+
+	// Every worker runs with a context derived from ctx, cancelled when the test is closed or on shutdown
+	ctx       context.Context
+	muCancels sync.Mutex
+	cancels   map[string]context.CancelFunc
+	workers   sync.WaitGroup
+
+	limiter *limiter
+	probes  *probes
 }
 
-func New(db *sqlx.DB, buz *bus.Bus) *Scheduler {
+func New(closing <-chan struct{}, db *sqlx.DB, buz *bus.Bus) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
 	s := &Scheduler{
-		db:         db,
-		buz:        buz,
-		tests:      make(map[string]pingr.GenericTest),
-		closeChans: make(map[string]chan struct{}),
+		db:      db,
+		buz:     buz,
+		tests:   make(map[string]pingr.GenericTest),
+		ctx:     ctx,
+		cancels: make(map[string]context.CancelFunc),
+		limiter: newLimiter(config.Get().MaxConcurrentTests, config.Get().MaxConcurrentPerHost),
+		probes:  newProbes(),
 	}
 
-	go s.discSpaceMaintainer()
+	go func() {
+		<-closing
+		cancel()
+	}()
 
-	go s.dataBaseListener() // Best way to handle DB error??
+	go s.discSpaceMaintainer()
 
-	go s.handleTimeouts()
+	go s.changeListener()
 
-	s.initVars()
+	if config.Get().HA {
+		go ha.Elect(closing, db, s.lead)
+	} else {
+		s.initVars()
+	}
 
 	go s.commands()
 
 	return s
 }
 
-func (s *Scheduler) closeTest(testId string) error {
-	if c, ok := s.closeChans[testId]; ok {
-		close(c)
-		delete(s.closeChans, testId)
+// Wait blocks until all workers have stopped after shutdown, or until the termination duration has passed
+func (s *Scheduler) Wait() {
+	done := make(chan struct{})
+	go func() {
+		s.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("All workers have stopped")
+	case <-time.After(config.Get().TermDuration):
+		log.Warn("Workers did not stop in time")
+	}
+}
+
+// startWorker starts a worker for the test, stopping any previous worker of the same test
+func (s *Scheduler) startWorker(test pingr.GenericTest) {
+	if s.ctx.Err() != nil {
+		return // Shutting down
+	}
+	testId := test.TestId
+	if !s.runsLocally(testId) {
+		s.stopWorker(testId) // Run by agents only
+		return
+	}
+
+	s.muCancels.Lock()
+	if cancel, ok := s.cancels[testId]; ok {
+		cancel()
 	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.cancels[testId] = cancel
+	s.muCancels.Unlock()
+
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		s.worker(ctx, test)
+	}()
+}
+
+// lead starts all tests when leadership is gained, and stops them when it is lost
+func (s *Scheduler) lead(leader bool) {
+	if leader {
+		s.initVars()
+		return
+	}
+
+	s.muTests.Lock()
+	defer s.muTests.Unlock()
+	for testId := range s.tests {
+		s.stopWorker(testId)
+		delete(s.tests, testId)
+	}
+}
+
+func (s *Scheduler) stopWorker(testId string) {
+	s.muCancels.Lock()
+	defer s.muCancels.Unlock()
+	if cancel, ok := s.cancels[testId]; ok {
+		cancel()
+		delete(s.cancels, testId)
+	}
+}
+
+func (s *Scheduler) closeTest(testId string) error {
+	s.stopWorker(testId)
 
 	err := s.buz.Close(fmt.Sprintf("push:%s", testId))
 	if err != nil {
@@ -86,106 +181,298 @@ func (s *Scheduler) closeTest(testId string) error {
 func (s *Scheduler) commands() {
 	go func() {
 		for {
-			data, err := s.buz.Next("deactivate", time.Minute)
+			data, err := s.buz.Next("run", time.Minute)
 			if err != nil {
 				// Probably a timeout
 				// could be channel closed, but it should be fixed next iteration
 				continue
 			}
-			testId := string(data)
-			err = s.closeTest(testId)
+			if !ha.IsLeader() {
+				continue
+			}
+			var req pingr.RunRequest
+			err = json.Unmarshal(data, &req)
 			if err != nil {
-				log.Error(err)
+				log.Error("could not unmarshal run request: ", err)
+				continue
 			}
-			addTestLog(testId, Paused, 0, nil, s.db)
+			s.workers.Add(1)
+			go func() {
+				defer s.workers.Done()
+				s.runNow(req)
+			}()
 		}
 	}()
 
 	go func() {
 		for {
-			data, err := s.buz.Next("delete", time.Minute)
+			data, err := s.buz.Next("result", time.Minute)
 			if err != nil {
 				// Probably a timeout
 				// could be channel closed, but it should be fixed next iteration
 				continue
 			}
-			err = s.closeTest(string(data))
+			var r pingr.AgentResult
+			err = json.Unmarshal(data, &r)
 			if err != nil {
-				log.Error(err)
+				log.Error("could not unmarshal agent result: ", err)
+				continue
 			}
+			go s.reportAgentResult(r)
 		}
 	}()
+}
 
-	go func() {
-		for {
-			data, err := s.buz.Next("new", time.Minute)
-			if err != nil {
-				// Probably a timeout
-				// could be channel closed, but it should be fixed next iteration
-				continue
+// startTest starts, or restarts, the test
+func (s *Scheduler) startTest(test pingr.GenericTest) {
+	s.muTests.Lock()
+	testId := test.Get().TestId
+	s.tests[testId] = test
+	s.muTests.Unlock()
+
+	addTestLog(testId, Initialized, 0, nil, s.db)
+
+	s.startWorker(test)
+}
+
+func (s *Scheduler) worker(ctx context.Context, test pingr.GenericTest) {
+	// Spread out execution of tests
+	if !config.Get().Dev && test.Cron == "" {
+		initSleep := rand.Int63n(int64((test.Timeout + test.Interval) / 2))
+		select {
+		case <-time.After(time.Duration(initSleep) * time.Second):
+		case <-ctx.Done():
+			return
+		}
+	}
+	interval := test.Interval * time.Second
+	for {
+		if test.Cron != "" {
+			ok := s.awaitSchedule(ctx, test)
+			if !ok {
+				return
 			}
-			var test pingr.GenericTest
-			err = json.Unmarshal(data, &test)
-			if err != nil {
-				log.Error("could not unmarshal test: ", err)
-				continue
+		}
+		if test.HasWindow() {
+			ok := s.awaitWindow(ctx, test)
+			if !ok {
+				return
 			}
+		}
 
-			s.muTests.Lock()
-			testId := test.Get().TestId
-			s.tests[testId] = test
-			s.muTests.Unlock()
+		res := s.run(ctx, test, 0)
 
-			if _, ok := s.closeChans[testId]; ok {
-				close(s.closeChans[testId])
-				delete(s.closeChans, testId)
+		// Failures are only confirmed once all retries have failed, hung probes are not retried
+		for attempt := 1; res.err != nil && !res.hung && attempt <= int(test.Retries); attempt++ {
+			if ctx.Err() != nil {
+				return
 			}
+			addTestLog(test.TestId, Retried, res.rt, res.err, s.db)
 
-			addTestLog(testId, Initialized, 0, nil, s.db)
+			select {
+			case <-time.After(test.RetryDelay * time.Second):
+			case <-ctx.Done():
+				return
+			}
+			res = s.run(ctx, test, attempt)
+		}
 
-			s.closeChans[testId] = make(chan struct{})
-			go s.worker(test, s.closeChans[testId])
+		// Avoid adding logs after the test was closed
+		if ctx.Err() != nil {
+			return
 		}
-	}()
+		s.reportTestResponse(test.BaseTest, res)
 
+		if res.hung {
+			// The hung probe is left behind, the test continues in a fresh worker
+			log.Warn(fmt.Sprintf("TestID: %s, restarting worker after hung probe", test.TestId))
+			s.startWorker(test)
+			return
+		}
+
+		interval = test.NextInterval(interval, res.err != nil)
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return
+		}
+	}
 }
 
-func (s *Scheduler) worker(test pingr.GenericTest, close chan struct{}) {
-	// Spread out execution of tests
-	if !config.Get().Dev {
-		initSleep := rand.Int63n(int64((test.Timeout + test.Interval)/2))
-		time.Sleep(time.Duration(initSleep) * time.Second)
+type result struct {
+	rt       time.Duration
+	err      error
+	timedOut bool
+	manual   bool
+	hung     bool      // the probe did not return in time and was abandoned by the watchdog
+	location string    // "" for local runs
+	message  string    // Logged on success, e.g. what was pushed
+	at       time.Time // When the test was run, if not just now, e.g. by an agent
+}
+
+// run runs, or retries, the test once within its deadline, once there is a free slot for it.
+// Runs exceeding the deadline are reported as timed out, and probes ignoring the deadline are abandoned
+// by a watchdog once the grace has passed as well
+func (s *Scheduler) run(ctx context.Context, test pingr.GenericTest, attempt int) result {
+	release := func() {}
+	if limited(test.BaseTest) {
+		var err error
+		release, err = s.limiter.acquire(ctx, targetHost(test.BaseTest))
+		if err != nil {
+			return result{err: err} // Closed while waiting
+		}
+	}
+
+	probe := func(ctx context.Context) (time.Duration, string, error) {
+		if attempt == 0 {
+			return test.RunTestExcerpt(ctx, s.buz)
+		}
+		rt, err := test.RetryTest(ctx, s.buz, attempt)
+		return rt, "", err
+	}
+	return s.probes.run(ctx, test.TestId, test.Deadline(), WatchdogGrace, release, probe)
+}
+
+// runNow runs the test once, out of schedule, and publishes the resulting log on the reply topic
+func (s *Scheduler) runNow(req pingr.RunRequest) {
+	res := s.run(s.ctx, req.Test, 0)
+	if s.ctx.Err() != nil {
+		return // Shutting down
+	}
+	res.manual = true
+	l := s.reportTestResponse(req.Test.BaseTest, res)
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		log.Error("could not marshal log: ", err)
+		return
+	}
+	err = s.buz.Publish(req.ReplyTopic, data)
+	if err != nil {
+		log.Error("could not reply to run request: ", err)
+	}
+}
+
+// awaitSchedule blocks until the next scheduled time of the test, false is returned if the test was closed
+func (s *Scheduler) awaitSchedule(ctx context.Context, test pingr.GenericTest) bool {
+	sched, err := test.Schedule()
+	if err != nil {
+		log.Error(fmt.Sprintf("TestID: %s, invalid schedule: %v", test.TestId, err))
+		<-ctx.Done()
+		return false
+	}
+
+	return s.awaitPushes(ctx, test, sched.Next(time.Now()))
+}
+
+// awaitWindow blocks until the test is within its active hours/days, false is returned if the test was closed
+func (s *Scheduler) awaitWindow(ctx context.Context, test pingr.GenericTest) bool {
+	window, err := test.Window()
+	if err != nil {
+		log.Error(fmt.Sprintf("TestID: %s, invalid active window: %v", test.TestId, err))
+		<-ctx.Done()
+		return false
 	}
+
+	now := time.Now()
+	if window.Contains(now) {
+		return true
+	}
+	addTestLog(test.TestId, Inactive, 0, nil, s.db)
+
+	return s.awaitPushes(ctx, test, window.Next(now))
+}
+
+// awaitPushes blocks until the time, false is returned if the test was closed. Pushes received meanwhile are
+// consumed, so pushers are not refused while the test is waiting, but are not counted unless received within
+// EarlyPush of the time, e.g. from a job on a clock slightly ahead
+func (s *Scheduler) awaitPushes(ctx context.Context, test pingr.GenericTest, until time.Time) bool {
+	topic := fmt.Sprintf("push:%s", test.TestId)
+	waitCtx, cancel := context.WithDeadline(ctx, until)
+	defer cancel()
+
+	var early []byte // Nil for plain pushes
+	var received bool
 	for {
-		rt, err := test.RunTest(s.buz)
+		data, err := s.buz.NextContext(waitCtx, topic)
+		if ctx.Err() != nil {
+			return false
+		}
+		if err == bus.TimeoutErr {
+			break
+		}
+		if err == nil && time.Until(until) <= EarlyPush {
+			early, received = data, true
+		}
+	}
 
-		// Avoid adding logs after timeouts etc
-		select {
-		case <-close:
-			return
-		default:
-			s.reportTestResponse(test.BaseTest, err, rt)
+	if received {
+		err := s.buz.Publish(topic, early)
+		if err != nil {
+			log.Warn(fmt.Sprintf("TestID: %s, could not keep early push: %v", test.TestId, err))
 		}
+	}
+	return true
+}
 
-		select {
-		case <-time.After(test.Get().Interval * time.Second):
-		case <-close:
-			return
+// reportTestResponse logs the result of a run and acts upon it, returning the log added
+func (s *Scheduler) reportTestResponse(test pingr.BaseTest, res result) pingr.Log {
+	if res.err != nil {
+		// Failures are still logged during maintenance, but no incident is created and no one is notified
+		if s.inMaintenance(test.TestId) {
+			return addRunLog(test.TestId, Maintenance, res, res.err, s.db)
+		}
+		status := Error
+		if res.timedOut {
+			status = TimedOut
 		}
+		l := addRunLog(test.TestId, status, res, res.err, s.db)
+		s.updateFlapping(test, res.err)
+		s.handleResult(test, res)
+		return l
 	}
+
+	status := Successful
+	degradedErr := s.degraded(test, res.rt)
+	if degradedErr != nil {
+		status = Degraded
+	}
+	l := addRunLog(test.TestId, status, res, degradedErr, s.db)
+	s.updateFlapping(test, nil)
+	s.updateDegraded(test, status, res.rt, degradedErr)
+	s.handleResult(test, res)
+	return l
 }
 
-func (s *Scheduler) reportTestResponse(test pingr.BaseTest, testErr error, rt time.Duration) {
+// handleResult opens, or closes, the incident of the test. Tests assigned to locations are failing
+// once the quorum of locations are failing, rather than on a single failed run
+func (s *Scheduler) handleResult(test pingr.BaseTest, res result) {
+	testErr := res.err
+	if locations := s.testLocations(test.TestId); len(locations) > 0 {
+		testErr = s.quorumFailure(test, locations)
+	}
 	if testErr != nil {
-		addTestLog(test.TestId, Error, rt, testErr, s.db)
 		s.handleError(test, testErr)
 		return
 	}
-
-	addTestLog(test.TestId, Successful, rt, testErr, s.db)
 	s.handleSuccess(test)
 }
 
+func (s *Scheduler) inMaintenance(testId string) bool {
+	maintenances, err := dao.GetTestMaintenances(testId, s.db)
+	if err != nil {
+		log.Error(fmt.Sprintf("could not get maintenance: %v", err))
+		return false
+	}
+	now := time.Now()
+	for _, m := range maintenances {
+		if m.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
 func (s *Scheduler) handleSuccess(test pingr.BaseTest) {
 	testId := test.TestId
 	incident, err := dao.GetActiveIncident(testId, s.db)
@@ -198,10 +485,13 @@ func (s *Scheduler) handleSuccess(test pingr.BaseTest) {
 		return
 	}
 
-	contacts, err := dao.GetIncidentContacts(incident.IncidentId, s.db)
-	if err != nil {
-		log.Error(fmt.Sprintf("could not get incident contacts: %v", err))
-		return
+	var contacts []pingr.Contact
+	if !s.isFlapping(testId) {
+		contacts, err = dao.GetIncidentContacts(incident.IncidentId, s.db)
+		if err != nil {
+			log.Error(fmt.Sprintf("could not get incident contacts: %v", err))
+			return
+		}
 	}
 	for _, contact := range contacts {
 		switch contact.ContactType {
@@ -232,6 +522,8 @@ func (s *Scheduler) handleError(test pingr.BaseTest, testErr error) {
 		return
 	}
 
+	parentId := s.failingParent(testId)
+
 	var incidentId uint64
 	if err == sql.ErrNoRows {
 		i := pingr.Incident{
@@ -239,6 +531,7 @@ func (s *Scheduler) handleError(test pingr.BaseTest, testErr error) {
 			Active:    true,
 			RootCause: testErr.Error(),
 			CreatedAt: time.Now(),
+			CausedBy:  parentId,
 		}
 		incidentId, err = dao.PostIncident(i, s.db)
 		if err != nil {
@@ -247,6 +540,18 @@ func (s *Scheduler) handleError(test pingr.BaseTest, testErr error) {
 		}
 	} else {
 		incidentId = incident.IncidentId
+		if incident.CausedBy != parentId {
+			// A parent started failing, or recovered while the test is still failing and the incident is now its own
+			err = dao.SetIncidentCause(incidentId, parentId, s.db)
+			if err != nil {
+				log.Error(fmt.Sprintf("could not update incident cause: %v", err))
+			}
+		}
+	}
+
+	// Contacts are notified through the failing parent instead, or once when the test started flapping
+	if parentId != "" || s.isFlapping(testId) {
+		return
 	}
 
 	contacts, err := dao.GetTestContactsToContact(testId, s.db)
@@ -278,98 +583,45 @@ func (s *Scheduler) handleError(test pingr.BaseTest, testErr error) {
 	}
 }
 
-func (s *Scheduler) handleTimeouts() {
-	for {
-		select {
-		case <-time.After(2 * time.Minute):
-			s.muTests.RLock()
-			for testId, test := range s.tests {
-				logs, err := dao.GetTestLogsLimited(testId, 1, s.db)
-				if err != nil || len(logs) == 0 {
-					log.Errorf("could not get test logs %v", err)
-					continue
-				}
-				// Latest log + interval + timeout < now -> TIMEOUT!
-				if time.Now().After(logs[0].CreatedAt.Add((test.Interval + 2*test.Timeout) * time.Second)) {
-					err := errors.New("test considered timed out while manually scanning for timeouts")
-					addTestLog(testId, TimedOut, (test.Interval+2*test.Timeout)*time.Second, err, s.db)
-					s.handleError(test.BaseTest, err)
-					testData, err := json.Marshal(test)
-					if err != nil {
-						log.Error("error marshaling test in timeout: " + err.Error())
-						continue
-					}
-					s.buz.Publish("new", testData)
-				}
-			}
-			s.muTests.RUnlock()
-
-		}
-
+// failingParent returns the id of a parent test that is failing, or has an active incident, if any
+func (s *Scheduler) failingParent(testId string) string {
+	parents, err := dao.GetTestParents(testId, s.db)
+	if err != nil {
+		log.Error(fmt.Sprintf("could not get test parents: %v", err))
+		return ""
 	}
-}
-
-func (s *Scheduler) dataBaseListener() {
-	for {
-		select {
-		case <-time.After(DataBaseListenerInterval):
-		}
-		log.Info("Looking for new/updated tests in DB")
-		testsDB, err := dao.GetRawTests(s.db)
-		if err != nil {
-			continue // Bad
+	for _, parentId := range parents {
+		_, err := dao.GetActiveIncident(parentId, s.db)
+		if err == nil {
+			return parentId
 		}
-
-		var newTests []pingr.GenericTest
-		var deletedTests []string
-
-		// Look for new/updated test
-		s.muTests.RLock()
-		for _, j := range testsDB {
-			if !reflect.DeepEqual(s.tests[j.Get().TestId], j) && j.Active { // Found a new/updated test
-				newTests = append(newTests, j)
-			}
-		}
-
-		// Look for deleted tests
-		for testId := range s.tests {
-			if !intInSlice(testId, testsDB) {
-				deletedTests = append(deletedTests, testId)
-			}
-		}
-		s.muTests.RUnlock()
-
-		// Save result in array and send on channel after Unlock to avoid deadlock
-		for _, newTest := range newTests {
-			data, err := json.Marshal(newTest)
-			if err != nil {
-				log.Error("could not marshal test: ", err.Error())
-				continue
-			}
-			err = s.buz.Publish("new", data)
-			if err != nil {
-				log.Error("could not add test: ", err.Error())
-			}
+		logs, err := dao.GetTestLogsLimited(parentId, 1, s.db)
+		if err != nil || len(logs) == 0 {
+			continue
 		}
-		for _, testId := range deletedTests {
-			err = s.buz.Publish("delete", []byte(testId))
-			if err != nil {
-				log.Error("could not delete test: ", err.Error())
-			}
+		switch logs[0].StatusId {
+		case Error, TimedOut, Retried:
+			return parentId
 		}
-
 	}
+	return ""
 }
 
 func (s *Scheduler) initVars() {
+	s.muTests.Lock()
+	defer s.muTests.Unlock()
+
+	// Changes from here on are picked up by the change listener
+	var err error
+	s.lastChange, err = dao.GetLastTestChange(s.db)
+	if err != nil {
+		log.Warn(err)
+	}
 	testsDB, err := dao.GetRawTests(s.db)
 	if err != nil {
 		log.Warn(err)
 	}
 
-	s.muTests.Lock()
-	defer s.muTests.Unlock()
-
 	for _, test := range testsDB {
 		if !test.Active {
 			continue
@@ -379,28 +631,43 @@ func (s *Scheduler) initVars() {
 
 		addTestLog(testId, Initialized, 0, nil, s.db)
 
-		s.closeChans[testId] = make(chan struct{})
-		go s.worker(test, s.closeChans[testId])
+		s.startWorker(test)
 	}
 }
 
 func addTestLog(testId string, statusCode uint, rt time.Duration, err error, db *sqlx.DB) {
-	var logMessage string
+	addRunLog(testId, statusCode, result{rt: rt}, err, db)
+}
+
+// addRunLog logs the result of a run with the given status and message
+func addRunLog(testId string, statusCode uint, res result, err error, db *sqlx.DB) pingr.Log {
+	logMessage := res.message
 	if err != nil {
 		logMessage = err.Error()
 	}
+	location := res.location
+	if location == "" {
+		location = pingr.LocalLocation
+	}
+	at := res.at
+	if at.IsZero() {
+		at = time.Now()
+	}
 	log.Info(fmt.Sprintf("TestID: %s, StatusCode: %d", testId, statusCode))
 	l := pingr.Log{
 		TestId:       testId,
 		StatusId:     statusCode,
 		Message:      logMessage,
-		ResponseTime: rt,
-		CreatedAt:    time.Now(),
+		ResponseTime: res.rt,
+		Manual:       res.manual,
+		Location:     location,
+		CreatedAt:    at,
 	}
-	err = dao.PostLog(l, db)
+	l.LogId, err = dao.PostLog(l, db)
 	if err != nil {
 		log.Warn(err)
 	}
+	return l
 }
 
 func (s *Scheduler) discSpaceMaintainer() {
@@ -426,12 +693,3 @@ func (s *Scheduler) discSpaceMaintainer() {
 		time.Sleep(time.Hour)
 	}
 }
-
-func intInSlice(a string, list []pingr.GenericTest) bool {
-	for _, b := range list {
-		if b.Get().TestId == a {
-			return true
-		}
-	}
-	return false
-}
@@ -6,6 +6,8 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
+	"golang.org/x/crypto/scrypt"
 	"io"
 	"pingr/internal/config"
 	"strings"
@@ -17,8 +19,19 @@ type Protected struct {
 }
 
 func (u *Protected) Seal() error {
+	key, _ := hex.DecodeString(config.Get().AESKey)
+	return u.SealWith(key)
+}
+
+func (u *Protected) Open() error {
+	key, _ := hex.DecodeString(config.Get().AESKey)
+	return u.OpenWith(key)
+}
+
+// SealWith seals the plain text with the given key rather than the AES key of the service
+func (u *Protected) SealWith(key []byte) error {
 	var err error
-	u.Cipher, err = seal([]byte(u.Plain))
+	u.Cipher, err = seal(key, []byte(u.Plain))
 	if err != nil {
 		return err
 	}
@@ -26,8 +39,8 @@ func (u *Protected) Seal() error {
 	return nil
 }
 
-func (u *Protected) Open() error {
-	data, err := open(u.Cipher)
+func (u *Protected) OpenWith(key []byte) error {
+	data, err := open(key, u.Cipher)
 	if err != nil {
 		return err
 	}
@@ -36,9 +49,19 @@ func (u *Protected) Open() error {
 	return nil
 }
 
-func seal(plaintext []byte) (string, error) {
-	key, _ := hex.DecodeString(config.Get().AESKey)
+// NewSalt returns a random salt for PassphraseKey
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, salt)
+	return salt, err
+}
+
+// PassphraseKey derives a 256 bit key from the passphrase, e.g. to seal exported credentials with
+func PassphraseKey(passphrase string, salt []byte) ([]byte, error) {
+	return scrypt.Key([]byte(passphrase), salt, 1<<15, 8, 1, 32)
+}
 
+func seal(key []byte, plaintext []byte) (string, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return "", err
@@ -59,15 +82,16 @@ func seal(plaintext []byte) (string, error) {
 	return base64.StdEncoding.EncodeToString(nonce) + "." + base64.StdEncoding.EncodeToString(ciphertext), nil
 
 }
-func open(data string) ([]byte, error) {
-	key, _ := hex.DecodeString(config.Get().AESKey)
-
+func open(key []byte, data string) ([]byte, error) {
 	block, err := aes.NewCipher(key)
 	if err != nil {
 		return nil, err
 	}
 
 	parts := strings.Split(data, ".")
+	if len(parts) != 2 {
+		return nil, errors.New("malformed cipher text")
+	}
 	nonce, err := base64.StdEncoding.DecodeString(parts[0])
 	if err != nil {
 		return nil, err
@@ -0,0 +1,66 @@
+package sec
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPassphraseRoundTrip(t *testing.T) {
+	salt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := PassphraseKey("correct horse", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != 32 {
+		t.Fatalf("expected a 256 bit key, got %d bytes", len(key))
+	}
+
+	p := Protected{Plain: "hunter2"}
+	if err := p.SealWith(key); err != nil {
+		t.Fatal(err)
+	}
+	if p.Plain != "" || p.Cipher == "" || bytes.Contains([]byte(p.Cipher), []byte("hunter2")) {
+		t.Fatalf("expected the plain text to be sealed, got %+v", p)
+	}
+	sealed := p.Cipher
+
+	// The same passphrase and salt derive the same key
+	again, err := PassphraseKey("correct horse", salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.OpenWith(again); err != nil {
+		t.Fatal(err)
+	}
+	if p.Plain != "hunter2" || p.Cipher != "" {
+		t.Fatalf("expected the plain text back, got %+v", p)
+	}
+
+	otherSalt, err := NewSalt()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, derive := range map[string]func() ([]byte, error){
+		"passphrase": func() ([]byte, error) { return PassphraseKey("wrong horse", salt) },
+		"salt":       func() ([]byte, error) { return PassphraseKey("correct horse", otherSalt) },
+	} {
+		key, err := derive()
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := Protected{Cipher: sealed}
+		if err := p.OpenWith(key); err == nil {
+			t.Logf("expected opening with another %s to fail", name)
+			t.Fail()
+		}
+	}
+
+	p = Protected{Cipher: "not sealed"}
+	if err := p.OpenWith(key); err == nil {
+		t.Log("expected malformed cipher text to fail")
+		t.Fail()
+	}
+}
@@ -0,0 +1,71 @@
+package sec
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"io"
+	"strings"
+)
+
+// NewToken returns a random, hex encoded, 256 bit token
+func NewToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// HashToken returns the hash of a token, which is what should be stored
+func HashToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+func CompareToken(token string, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashToken(token)), []byte(hash)) == 1
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of the message using secret as key
+func Sign(secret string, message []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(message)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifySignature(secret string, message []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, message)), []byte(signature))
+}
+
+// HashPassword returns a salted scrypt hash of the password, "scrypt$<salt>$<hash>" base64 encoded, to be stored
+func HashPassword(password string) (string, error) {
+	salt, err := NewSalt()
+	if err != nil {
+		return "", err
+	}
+	key, err := PassphraseKey(password, salt)
+	if err != nil {
+		return "", err
+	}
+	return "scrypt$" + base64.StdEncoding.EncodeToString(salt) + "$" + base64.StdEncoding.EncodeToString(key), nil
+}
+
+func ComparePassword(password string, hash string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 3 || parts[0] != "scrypt" {
+		return false
+	}
+	salt, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+	key, err := PassphraseKey(password, salt)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(base64.StdEncoding.EncodeToString(key)), []byte(parts[2])) == 1
+}
@@ -1,16 +1,21 @@
 package pingr
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/jmoiron/sqlx/types"
+	"net"
+	"net/url"
 	"pingr/internal/bus"
 	"pingr/internal/platform/dns"
 	"pingr/internal/poll"
 	"pingr/internal/push"
+	"pingr/internal/schedule"
 	"pingr/internal/sec"
+	"strings"
 	"time"
 )
 
@@ -20,9 +25,147 @@ type Log struct {
 	StatusId     uint          `json:"status_id" db:"status_id"`
 	Message      string        `json:"message" db:"message"`
 	ResponseTime time.Duration `json:"response_time" db:"response_time"`
+	Manual       bool          `json:"manual" db:"manual"`     // Run on request rather than by schedule
+	Location     string        `json:"location" db:"location"` // Where the test was run from, LocalLocation or an agent's
 	CreatedAt    time.Time     `json:"created_at" db:"created_at"`
 }
 
+// LocalLocation is the location of pingrd itself. Tests not assigned to any location are only run locally
+const LocalLocation = "local"
+
+// Agent runs tests assigned to its location from another network/region, reporting the results back to pingrd
+type Agent struct {
+	AgentId   string       `json:"agent_id" db:"agent_id"`
+	AgentName string       `json:"agent_name" db:"agent_name"`
+	Location  string       `json:"location" db:"location"`
+	TokenHash string       `json:"-" db:"token_hash"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+	LastSeen  sql.NullTime `json:"last_seen" db:"last_seen"`
+}
+
+func (a Agent) Validate() bool {
+	if a.AgentId == "" {
+		return false
+	}
+	if a.AgentName == "" {
+		return false
+	}
+	if a.Location == "" || a.Location == LocalLocation {
+		return false
+	}
+	return true
+}
+
+const (
+	RoleViewer = "viewer" // Read everything but credentials
+	RoleEditor = "editor" // Also change tests, contacts, incidents and maintenance
+	RoleAdmin  = "admin"  // Also manage users, tokens, agents, export and import
+)
+
+// RoleRank orders the roles by their permissions, it is 0 for invalid roles
+func RoleRank(role string) int {
+	switch role {
+	case RoleViewer:
+		return 1
+	case RoleEditor:
+		return 2
+	case RoleAdmin:
+		return 3
+	}
+	return 0
+}
+
+func ValidRole(role string) bool {
+	return RoleRank(role) > 0
+}
+
+// User signs in with basic auth, or through the API tokens of the user
+type User struct {
+	UserId       string    `json:"user_id" db:"user_id"`
+	Username     string    `json:"username" db:"username"`
+	Password     string    `json:"password,omitempty" db:"-"` // Only set on input
+	PasswordHash string    `json:"-" db:"password_hash"`
+	Role         string    `json:"role" db:"role"`
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+func (u User) Validate() bool {
+	if u.UserId == "" {
+		return false
+	}
+	if u.Username == "" || strings.ContainsAny(u.Username, ":") {
+		return false
+	}
+	if u.PasswordHash == "" {
+		return false
+	}
+	return ValidRole(u.Role)
+}
+
+const (
+	ScopeAll  = "all"  // Everything the role of the user allows
+	ScopeRead = "read" // Only reading, e.g. for dashboards
+	ScopePush = "push" // Only pushing to push tests, e.g. from CI
+)
+
+// APIToken authenticates as its user, limited to its scope, with "Authorization: Bearer <token>"
+type APIToken struct {
+	TokenId   string       `json:"token_id" db:"token_id"`
+	TokenName string       `json:"token_name" db:"token_name"`
+	UserId    string       `json:"user_id" db:"user_id"`
+	Scope     string       `json:"scope" db:"scope"`
+	TokenHash string       `json:"-" db:"token_hash"`
+	CreatedAt time.Time    `json:"created_at" db:"created_at"`
+	ExpiresAt sql.NullTime `json:"expires_at" db:"expires_at"`
+	LastUsed  sql.NullTime `json:"last_used" db:"last_used"`
+}
+
+func (t APIToken) Validate() bool {
+	if t.TokenId == "" || t.UserId == "" {
+		return false
+	}
+	if t.TokenName == "" {
+		return false
+	}
+	switch t.Scope {
+	case ScopeAll, ScopeRead, ScopePush:
+	default:
+		return false
+	}
+	return true
+}
+
+func (t APIToken) Expired(now time.Time) bool {
+	return t.ExpiresAt.Valid && !now.Before(t.ExpiresAt.Time)
+}
+
+// Session of a user signed in through OpenID Connect, identified by a cookie holding the token of the hash
+type Session struct {
+	SessionHash string    `json:"-" db:"session_hash"`
+	Subject     string    `json:"subject" db:"subject"` // "sub" of the identity provider
+	Username    string    `json:"username" db:"username"`
+	Role        string    `json:"role" db:"role"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	ExpiresAt   time.Time `json:"expires_at" db:"expires_at"`
+}
+
+// AgentResult is the result of a test run by an agent
+type AgentResult struct {
+	ResultId     string        `json:"result_id"` // Set by the agent, results sent more than once are only counted once
+	TestId       string        `json:"test_id"`
+	Location     string        `json:"location"` // Set by pingrd from the reporting agent
+	Error        string        `json:"error"`    // Empty if the test succeeded
+	ResponseTime time.Duration `json:"response_time"`
+	TimedOut     bool          `json:"timed_out"`
+	CreatedAt    time.Time     `json:"created_at"` // When the test was run
+}
+
+// RunRequest asks the scheduler to run the test right away, the resulting log is published on ReplyTopic
+type RunRequest struct {
+	Test       GenericTest `json:"test"`
+	ReplyTopic string      `json:"reply_topic"`
+}
+
 type Incident struct {
 	IncidentId uint64       `json:"incident_id" db:"incident_id"`
 	TestId     string       `json:"test_id" db:"test_id"`
@@ -30,6 +173,7 @@ type Incident struct {
 	RootCause  string       `json:"root_cause" db:"root_cause"`
 	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
 	ClosedAt   sql.NullTime `json:"closed_at" db:"closed_at"`
+	CausedBy   string       `json:"caused_by" db:"caused_by"` // Id of the failing parent test, if any
 }
 
 type IncidentContactLog struct {
@@ -83,9 +227,157 @@ func (c TestContact) Validate() bool {
 	return true
 }
 
+// Flapping is the state of a test alternating between success and failure, contacts are only notified on entry and exit
+type Flapping struct {
+	TestId      string    `json:"test_id" db:"test_id"`
+	StateChange float64   `json:"state_change" db:"state_change"` // %
+	StartedAt   time.Time `json:"started_at" db:"started_at"`
+}
+
+// Degradation is the degraded state of a test, from its first degraded run until its next successful run that is not
+type Degradation struct {
+	TestId    string    `json:"test_id" db:"test_id"`
+	Message   string    `json:"message" db:"message"`
+	StartedAt time.Time `json:"started_at" db:"started_at"`
+}
+
+// Maintenance suppresses incidents and notifications for the covered tests while active. A one-off window is active
+// between StartsAt and EndsAt, a recurring one for Duration seconds from each scheduled time of Cron between StartsAt and EndsAt
+type Maintenance struct {
+	MaintenanceId   string        `json:"maintenance_id" db:"maintenance_id"`
+	MaintenanceName string        `json:"maintenance_name" db:"maintenance_name"`
+	StartsAt        time.Time     `json:"starts_at" db:"starts_at"`
+	EndsAt          time.Time     `json:"ends_at" db:"ends_at"` // Optional for recurring windows
+	Cron            string        `json:"cron" db:"cron"`
+	Duration        time.Duration `json:"duration" db:"duration"`
+	TimeZone        string        `json:"time_zone" db:"time_zone"`
+	AllTests        bool          `json:"all_tests" db:"all_tests"`
+	TestIds         []string      `json:"test_ids" db:"-"`
+	Tags            []string      `json:"tags" db:"-"` // Covers the tests with any of the tags
+	CreatedAt       time.Time     `json:"created_at" db:"created_at"`
+}
+
+func (m Maintenance) Schedule() (schedule.Schedule, error) {
+	return schedule.Parse(m.Cron, m.TimeZone)
+}
+
+func (m Maintenance) Validate() bool {
+	if m.MaintenanceId == "" {
+		return false
+	}
+	if m.MaintenanceName == "" {
+		return false
+	}
+	if m.AllTests == (len(m.TestIds) > 0 || len(m.Tags) > 0) {
+		return false
+	}
+	for _, tag := range m.Tags {
+		if !ValidTag(tag) {
+			return false
+		}
+	}
+	if m.Cron == "" {
+		return m.EndsAt.After(m.StartsAt)
+	}
+	if m.Duration <= 0 {
+		return false
+	}
+	if !m.EndsAt.IsZero() && !m.EndsAt.After(m.StartsAt) {
+		return false
+	}
+	_, err := m.Schedule()
+	return err == nil
+}
+
+// Active reports whether the maintenance is ongoing at t
+func (m Maintenance) Active(t time.Time) bool {
+	if t.Before(m.StartsAt) {
+		return false
+	}
+	if !m.EndsAt.IsZero() && !t.Before(m.EndsAt) {
+		return false
+	}
+	if m.Cron == "" {
+		return true
+	}
+
+	sched, err := m.Schedule()
+	if err != nil {
+		return false
+	}
+	// A window is ongoing if it was scheduled to start within the last duration
+	start := sched.Next(t.Add(-m.Duration * time.Second))
+	return !start.After(t)
+}
+
+// PushAuth restricts who can push to a push test. The token is stored hashed and the HMAC secret sealed
+type PushAuth struct {
+	TestId     string    `json:"test_id" db:"test_id"`
+	TokenHash  string    `json:"-" db:"token_hash"`
+	HMACSecret string    `json:"-" db:"hmac_secret"`
+	AllowedIPs string    `json:"allowed_ips" db:"allowed_ips"` // Space separated IPs and CIDRs
+	UpdatedAt  time.Time `json:"updated_at" db:"updated_at"`
+}
+
+func (a PushAuth) IPs() []string {
+	return strings.Fields(a.AllowedIPs)
+}
+
+func (a PushAuth) Validate() bool {
+	if a.TestId == "" {
+		return false
+	}
+	for _, ip := range a.IPs() {
+		if net.ParseIP(ip) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(ip); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// AllowsIP is true if no IPs are specified or if ip matches one of them
+func (a PushAuth) AllowsIP(ip string) bool {
+	ips := a.IPs()
+	if len(ips) == 0 {
+		return true
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	for _, allowed := range ips {
+		if allowedAddr := net.ParseIP(allowed); allowedAddr != nil {
+			if allowedAddr.Equal(addr) {
+				return true
+			}
+			continue
+		}
+		_, network, err := net.ParseCIDR(allowed)
+		if err == nil && network.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Test is run until done or until the context is done, the deadline of the context is set from Deadline
 type Test interface {
-	RunTest(buz *bus.Bus) (time.Duration, error)
+	RunTest(ctx context.Context, buz *bus.Bus) (time.Duration, error)
 	Validate() bool
+	Deadline() time.Duration
+}
+
+// Excerpter is implemented by tests with something worth keeping in the log when they pass, e.g. what was pushed
+type Excerpter interface {
+	RunTestExcerpt(ctx context.Context, buz *bus.Bus) (time.Duration, string, error)
+}
+
+// Retrier is implemented by tests that can be retried from a different resolver/ip than the system default
+type Retrier interface {
+	RetryTest(ctx context.Context, buz *bus.Bus, attempt int) (time.Duration, error)
 }
 
 type BaseTest struct {
@@ -97,12 +389,105 @@ type BaseTest struct {
 	Interval  time.Duration `json:"interval"`
 	CreatedAt time.Time     `json:"created_at" db:"created_at"`
 	Active    bool          `json:"active" db:"active"`
+
+	// Tests with a cron expression run, or for push tests expect a push, at each scheduled time instead of every interval
+	Cron     string `json:"cron" db:"cron"`
+	TimeZone string `json:"time_zone" db:"time_zone"`
+
+	// Push tests with a cron expression expect a push within the grace (seconds) of each scheduled time
+	Grace time.Duration `json:"grace" db:"grace"`
+
+	// Tests are only run within active hours/days, e.g. "07:00-19:00" and "mon-fri", evaluated in the time zone
+	ActiveHours string `json:"active_hours" db:"active_hours"`
+	ActiveDays  string `json:"active_days" db:"active_days"`
+
+	// Failures are retried before being confirmed, optionally from a different resolver/ip
+	Retries        uint          `json:"retries" db:"retries"`
+	RetryDelay     time.Duration `json:"retry_delay" db:"retry_delay"`
+	RetryAlternate bool          `json:"retry_alternate" db:"retry_alternate"`
+
+	// Successful runs slower than the threshold (ms), or than factor times the rolling p95, are logged as degraded
+	DegradedThreshold time.Duration `json:"degraded_threshold" db:"degraded_threshold"`
+	DegradedFactor    float64       `json:"degraded_factor" db:"degraded_factor"`
+	DegradedNotify    bool          `json:"degraded_notify" db:"degraded_notify"`
+
+	// While failing, the interval is multiplied by the factor after each run, up to the limit (seconds),
+	// or with a factor below 1 down to the limit to detect the recovery sooner
+	BackoffFactor float64       `json:"backoff_factor" db:"backoff_factor"`
+	BackoffLimit  time.Duration `json:"backoff_limit" db:"backoff_limit"`
+
+	// Tests assigned to several locations only open an incident once this many locations are failing, 0 meaning 1
+	LocationQuorum uint `json:"location_quorum" db:"location_quorum"`
+
+	// Tags group tests, e.g. by customer or team, to filter and act on them in bulk. Stored in test_tags
+	Tags []string `json:"tags" db:"-"`
 }
 
 func (j BaseTest) Get() BaseTest {
 	return j
 }
 
+func (j BaseTest) Schedule() (schedule.Schedule, error) {
+	return schedule.Parse(j.Cron, j.TimeZone)
+}
+
+func (j BaseTest) HasWindow() bool {
+	return j.ActiveHours != "" || j.ActiveDays != ""
+}
+
+func (j BaseTest) Window() (schedule.Window, error) {
+	return schedule.ParseWindow(j.ActiveHours, j.ActiveDays, j.TimeZone)
+}
+
+// NextInterval returns the time until the next run, given the previous interval and whether the test is failing
+func (j BaseTest) NextInterval(prev time.Duration, failing bool) time.Duration {
+	if !failing || j.BackoffFactor == 0 {
+		return j.Interval * time.Second
+	}
+	next := time.Duration(float64(prev) * j.BackoffFactor)
+	limit := j.BackoffLimit * time.Second
+	if (j.BackoffFactor > 1 && next > limit) || (j.BackoffFactor < 1 && next < limit) {
+		return limit
+	}
+	return next
+}
+
+// StaleAfter is the age after which results of the test no longer count, e.g. from an agent that has been down
+func (j BaseTest) StaleAfter() time.Duration {
+	return 2 * (j.MaxInterval() + j.Deadline())
+}
+
+// MaxInterval is the longest time between two runs of the test
+func (j BaseTest) MaxInterval() time.Duration {
+	if j.BackoffFactor > 1 {
+		return j.BackoffLimit * time.Second
+	}
+	return j.Interval * time.Second
+}
+
+// RemoteCapable reports whether the test can be run by agents. SSH credentials never leave pingrd
+func (j BaseTest) RemoteCapable() bool {
+	switch j.TestType {
+	case "HTTP", "Prometheus", "TLS", "DNS", "Ping", "TCP":
+		return true
+	}
+	return false
+}
+
+// Deadline is the longest a single run of the test is expected to take, for push tests waiting for a push
+func (j BaseTest) Deadline() time.Duration {
+	return j.PushWait()
+}
+
+// PushWait is how long push tests wait for a push, the grace after each scheduled time for tests with a cron
+// expression and the timeout otherwise
+func (j BaseTest) PushWait() time.Duration {
+	if j.Cron != "" && j.Grace > 0 {
+		return j.Grace * time.Second
+	}
+	return j.Timeout * time.Second
+}
+
 type GenericTest struct {
 	BaseTest
 	Blob types.JSONText `json:"blob" db:"blob"`
@@ -110,7 +495,7 @@ type GenericTest struct {
 	memoize Test
 }
 
-func (j GenericTest) RunTest(buz *bus.Bus) (time.Duration, error) {
+func (j GenericTest) RunTest(ctx context.Context, buz *bus.Bus) (time.Duration, error) {
 	var err error
 	if j.memoize == nil {
 		j.memoize, err = j.Impl()
@@ -118,7 +503,32 @@ func (j GenericTest) RunTest(buz *bus.Bus) (time.Duration, error) {
 			return 0, err
 		}
 	}
-	return j.memoize.RunTest(buz)
+	return j.memoize.RunTest(ctx, buz)
+}
+
+// RunTestExcerpt runs the test, returning what to keep in the log if it passes, if anything
+func (j GenericTest) RunTestExcerpt(ctx context.Context, buz *bus.Bus) (time.Duration, string, error) {
+	t, err := j.Impl()
+	if err != nil {
+		return 0, "", err
+	}
+	if e, ok := t.(Excerpter); ok {
+		return e.RunTestExcerpt(ctx, buz)
+	}
+	rt, err := t.RunTest(ctx, buz)
+	return rt, "", err
+}
+
+// RetryTest runs the test again after a failure, from a different resolver/ip if RetryAlternate is set and supported
+func (j GenericTest) RetryTest(ctx context.Context, buz *bus.Bus, attempt int) (time.Duration, error) {
+	t, err := j.Impl()
+	if err != nil {
+		return 0, err
+	}
+	if r, ok := t.(Retrier); ok && j.RetryAlternate {
+		return r.RetryTest(ctx, buz, attempt)
+	}
+	return t.RunTest(ctx, buz)
 }
 
 func (j GenericTest) Validate() bool {
@@ -132,6 +542,14 @@ func (j GenericTest) Validate() bool {
 	return j.memoize.Validate()
 }
 
+func (j GenericTest) Deadline() time.Duration {
+	t, err := j.Impl()
+	if err != nil {
+		return j.BaseTest.Deadline()
+	}
+	return t.Deadline()
+}
+
 func (j GenericTest) Impl() (parsedTest Test, err error) {
 	switch j.TestType {
 	case "SSH":
@@ -197,6 +615,28 @@ func (j GenericTest) Impl() (parsedTest Test, err error) {
 	case "HTTPPush":
 		var t HTTPPushTest
 		t.BaseTest = j.BaseTest
+		if len(j.Blob) > 0 {
+			err = json.Unmarshal(j.Blob, &t.Blob)
+			if err != nil {
+				return
+			}
+		}
+		parsedTest = t
+	case "LinePush":
+		var t LinePushTest
+		t.BaseTest = j.BaseTest
+		err = json.Unmarshal(j.Blob, &t.Blob)
+		if err != nil {
+			return
+		}
+		parsedTest = t
+	case "JSONPush":
+		var t JSONPushTest
+		t.BaseTest = j.BaseTest
+		err = json.Unmarshal(j.Blob, &t.Blob)
+		if err != nil {
+			return
+		}
 		parsedTest = t
 	default:
 		err = errors.New(j.TestType + " is not a valid test type")
@@ -219,19 +659,78 @@ func (j BaseTest) Validate() bool {
 		if j.Interval < 0 {
 			return false
 		}
-	case "HTTPPush", "PrometheusPush":
+		if j.Cron != "" {
+			if j.Interval != 0 {
+				return false
+			}
+			if _, err := j.Schedule(); err != nil {
+				return false
+			}
+		}
+		if j.Grace != 0 {
+			return false
+		}
+	case "HTTPPush", "PrometheusPush", "JSONPush", "LinePush":
 		if j.Interval != 0 {
 			return false
 		}
+		if j.Retries != 0 {
+			return false
+		}
+		if j.Cron != "" {
+			if _, err := j.Schedule(); err != nil {
+				return false
+			}
+			if j.Grace <= 0 {
+				return false
+			}
+		} else if j.Grace != 0 {
+			return false
+		}
 	default:
 		return false
 	}
 	if j.Timeout == 0 {
 		return false
 	}
+	if j.RetryDelay < 0 {
+		return false
+	}
+	if j.DegradedThreshold < 0 {
+		return false
+	}
+	if j.DegradedFactor != 0 && j.DegradedFactor < 1 {
+		return false
+	}
+	if j.BackoffFactor != 0 {
+		if j.BackoffFactor < 0 || j.BackoffFactor == 1 || j.Interval <= 0 {
+			return false
+		}
+		if j.BackoffFactor > 1 && j.BackoffLimit < j.Interval {
+			return false
+		}
+		if j.BackoffFactor < 1 && (j.BackoffLimit < 1 || j.BackoffLimit > j.Interval) {
+			return false
+		}
+	}
+	if j.HasWindow() {
+		if _, err := j.Window(); err != nil {
+			return false
+		}
+	}
+	for _, tag := range j.Tags {
+		if !ValidTag(tag) {
+			return false
+		}
+	}
 	return true
 }
 
+// ValidTag reports whether the tag is non-empty and free of whitespace and commas, so tags can be listed in arguments
+func ValidTag(tag string) bool {
+	return tag != "" && !strings.ContainsAny(tag, ", \t\n")
+}
+
 type SSHTest struct {
 	Blob struct {
 		CredentialType string `json:"credential_type"`
@@ -242,8 +741,8 @@ type SSHTest struct {
 	BaseTest
 }
 
-func (t SSHTest) RunTest(*bus.Bus) (time.Duration, error) {
-	return poll.SSH(t.Url, t.Blob.Port, t.Timeout, t.Blob.Username, t.Blob.CredentialType, t.Blob.Credential)
+func (t SSHTest) RunTest(ctx context.Context, _ *bus.Bus) (time.Duration, error) {
+	return poll.SSH(ctx, t.Url, t.Blob.Port, t.Blob.Username, t.Blob.CredentialType, t.Blob.Credential)
 }
 
 func (t SSHTest) Validate() bool {
@@ -261,8 +760,10 @@ func (t SSHTest) Validate() bool {
 	if t.Blob.Port == "" {
 		return false
 	}
-	if t.Blob.Credential == "" {
-		return false //Maybe some ssh servers won't require password but I guess most do
+	if t.Blob.Credential == "" && t.Active {
+		// Maybe some ssh servers won't require password but I guess most do. Paused tests may lack it until it is
+		// set, e.g. when imported without credentials
+		return false
 	}
 	return true
 }
@@ -274,8 +775,16 @@ type TCPTest struct {
 	BaseTest
 }
 
-func (t TCPTest) RunTest(*bus.Bus) (time.Duration, error) {
-	return poll.TCP(t.Url, t.Blob.Port, t.Timeout)
+func (t TCPTest) RunTest(ctx context.Context, _ *bus.Bus) (time.Duration, error) {
+	return poll.TCP(ctx, t.Url, t.Blob.Port)
+}
+
+func (t TCPTest) RetryTest(ctx context.Context, _ *bus.Bus, attempt int) (time.Duration, error) {
+	ip, err := poll.Alternate(ctx, dns.Alternates(), t.Url, attempt)
+	if err != nil {
+		return 0, err
+	}
+	return poll.TCP(ctx, ip, t.Blob.Port)
 }
 
 func (t TCPTest) Validate() bool {
@@ -296,8 +805,8 @@ type TLSTest struct {
 	BaseTest
 }
 
-func (t TLSTest) RunTest(*bus.Bus) (time.Duration, error) {
-	return poll.TLS(t.Url, t.Blob.Port, t.Blob.AllowUnauthorizedOCSP, t.Timeout)
+func (t TLSTest) RunTest(ctx context.Context, _ *bus.Bus) (time.Duration, error) {
+	return poll.TLS(ctx, t.Url, t.Blob.Port, t.Blob.AllowUnauthorizedOCSP)
 }
 
 func (t TLSTest) Validate() bool {
@@ -315,8 +824,16 @@ type PingTest struct {
 	BaseTest
 }
 
-func (t PingTest) RunTest(*bus.Bus) (time.Duration, error) {
-	return poll.Ping(t.Url, t.Timeout)
+func (t PingTest) RunTest(ctx context.Context, _ *bus.Bus) (time.Duration, error) {
+	return poll.Ping(ctx, t.Url)
+}
+
+func (t PingTest) RetryTest(ctx context.Context, _ *bus.Bus, attempt int) (time.Duration, error) {
+	ip, err := poll.Alternate(ctx, dns.Alternates(), t.Url, attempt)
+	if err != nil {
+		return 0, err
+	}
+	return poll.Ping(ctx, ip)
 }
 
 func (t PingTest) Validate() bool {
@@ -339,8 +856,20 @@ type HTTPTest struct {
 	BaseTest
 }
 
-func (t HTTPTest) RunTest(*bus.Bus) (time.Duration, error) {
-	return poll.HTTP(t.Url, t.Blob.ReqMethod, t.Timeout*time.Second, t.Blob.ReqHeaders, t.Blob.ReqBody, t.Blob.ResStatus, t.Blob.ResHeaders, t.Blob.ResBody)
+func (t HTTPTest) RunTest(ctx context.Context, _ *bus.Bus) (time.Duration, error) {
+	return poll.HTTP(ctx, t.Url, t.Blob.ReqMethod, t.Blob.ReqHeaders, t.Blob.ReqBody, t.Blob.ResStatus, t.Blob.ResHeaders, t.Blob.ResBody, "")
+}
+
+func (t HTTPTest) RetryTest(ctx context.Context, _ *bus.Bus, attempt int) (time.Duration, error) {
+	u, err := url.Parse(t.Url)
+	if err != nil {
+		return 0, err
+	}
+	ip, err := poll.Alternate(ctx, dns.Alternates(), u.Hostname(), attempt)
+	if err != nil {
+		return 0, err
+	}
+	return poll.HTTP(ctx, t.Url, t.Blob.ReqMethod, t.Blob.ReqHeaders, t.Blob.ReqBody, t.Blob.ResStatus, t.Blob.ResHeaders, t.Blob.ResBody, ip)
 }
 
 func (t HTTPTest) Validate() bool {
@@ -367,8 +896,8 @@ type DNSTest struct {
 	BaseTest
 }
 
-func (t DNSTest) RunTest(*bus.Bus) (time.Duration, error) {
-	return poll.DNS(dns.Get(), t.Url, t.Timeout*time.Second, t.Blob.Record, t.Blob.Strategy, t.Blob.Check)
+func (t DNSTest) RunTest(ctx context.Context, _ *bus.Bus) (time.Duration, error) {
+	return poll.DNS(ctx, dns.Get(), t.Url, t.Blob.Record, t.Blob.Strategy, t.Blob.Check)
 }
 
 func (t DNSTest) Validate() bool {
@@ -388,8 +917,8 @@ type PrometheusTest struct {
 	BaseTest
 }
 
-func (t PrometheusTest) RunTest(*bus.Bus) (time.Duration, error) {
-	return poll.Prometheus(t.TestId, t.Url, t.Timeout*time.Second, t.Blob.MetricTests)
+func (t PrometheusTest) RunTest(ctx context.Context, _ *bus.Bus) (time.Duration, error) {
+	return poll.Prometheus(ctx, t.TestId, t.Url, t.Blob.MetricTests)
 }
 
 func (t PrometheusTest) Validate() bool {
@@ -408,24 +937,93 @@ func (t PrometheusTest) Validate() bool {
 }
 
 type HTTPPushTest struct {
-	Blob struct{} `json:"blob"`
+	Blob struct {
+		MaxRuntime time.Duration `json:"max_runtime"`
+	} `json:"blob"`
 	BaseTest
 }
 
-func (t HTTPPushTest) RunTest(buz *bus.Bus) (time.Duration, error) {
+func (t HTTPPushTest) RunTest(ctx context.Context, buz *bus.Bus) (time.Duration, error) {
 	start := time.Now()
-	_, err := buz.Next(fmt.Sprintf("push:%s", t.TestId), t.Timeout*time.Second)
+	data, err := nextPush(ctx, buz, t.TestId, t.PushWait())
+	if err != nil {
+		return time.Since(start), err
+	}
 
-	return time.Since(start), err
+	heartbeat := push.DecodeHeartbeat(data)
+	switch heartbeat.Signal {
+	case push.Start:
+		return t.awaitFinish(ctx, buz)
+	case push.Fail:
+		return time.Since(start), jobFailed(heartbeat.Message)
+	case push.Finish:
+		return 0, nil // The start was missed, the duration of the job is unknown
+	}
+	return time.Since(start), nil
+}
+
+// awaitFinish waits for a started job to finish, the duration of the job is used as response time
+func (t HTTPPushTest) awaitFinish(ctx context.Context, buz *bus.Bus) (time.Duration, error) {
+	maxRuntime := t.maxRuntime()
+	start := time.Now()
+	for {
+		data, err := nextPush(ctx, buz, t.TestId, time.Until(start.Add(maxRuntime)))
+		if err == bus.TimeoutErr {
+			return time.Since(start), fmt.Errorf("job started but did not finish within max runtime of %s", maxRuntime)
+		}
+		if err != nil {
+			return time.Since(start), err
+		}
+
+		heartbeat := push.DecodeHeartbeat(data)
+		switch heartbeat.Signal {
+		case push.Finish:
+			return time.Since(start), nil
+		case push.Fail:
+			return time.Since(start), jobFailed(heartbeat.Message)
+		case push.Start:
+			// Job was restarted, measure from the latest start
+			start = time.Now()
+		}
+		// Plain pushes while the job is running are ignored
+	}
+}
+
+func (t HTTPPushTest) maxRuntime() time.Duration {
+	if t.Blob.MaxRuntime == 0 {
+		return t.Timeout * time.Second
+	}
+	return t.Blob.MaxRuntime * time.Second
+}
+
+func (t HTTPPushTest) Deadline() time.Duration {
+	return t.PushWait() + t.maxRuntime()
 }
 
 func (t HTTPPushTest) Validate() bool {
 	if !t.BaseTest.Validate() {
 		return false
 	}
+	if t.Blob.MaxRuntime < 0 {
+		return false
+	}
 	return true
 }
 
+// nextPush waits for the next push to the test, at most timeout
+func nextPush(ctx context.Context, buz *bus.Bus, testId string, timeout time.Duration) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return buz.NextContext(ctx, fmt.Sprintf("push:%s", testId))
+}
+
+func jobFailed(message string) error {
+	if message == "" {
+		return errors.New("job reported failure")
+	}
+	return fmt.Errorf("job reported failure: %s", message)
+}
+
 type PrometheusPushTest struct {
 	Blob struct {
 		MetricTests []push.MetricTest `json:"metric_tests"`
@@ -433,9 +1031,9 @@ type PrometheusPushTest struct {
 	BaseTest
 }
 
-func (t PrometheusPushTest) RunTest(buz *bus.Bus) (time.Duration, error) {
+func (t PrometheusPushTest) RunTest(ctx context.Context, buz *bus.Bus) (time.Duration, error) {
 	start := time.Now()
-	reqBody, err := buz.Next(fmt.Sprintf("push:%s", t.TestId), t.Timeout*time.Second)
+	reqBody, err := nextPush(ctx, buz, t.TestId, t.PushWait())
 	if err != nil {
 		return time.Since(start), err
 	}
@@ -459,6 +1057,91 @@ func (t PrometheusPushTest) Validate() bool {
 	return true
 }
 
+type JSONPushTest struct {
+	Blob struct {
+		Required   []string             `json:"required"`
+		Status     push.JSONStatus      `json:"status"`
+		Assertions []push.JSONAssertion `json:"assertions"`
+	} `json:"blob"`
+	BaseTest
+}
+
+func (t JSONPushTest) RunTest(ctx context.Context, buz *bus.Bus) (time.Duration, error) {
+	rt, _, err := t.RunTestExcerpt(ctx, buz)
+	return rt, err
+}
+
+// RunTestExcerpt runs the test, returning an excerpt of what was pushed to keep in the log
+func (t JSONPushTest) RunTestExcerpt(ctx context.Context, buz *bus.Bus) (time.Duration, string, error) {
+	start := time.Now()
+	reqBody, err := nextPush(ctx, buz, t.TestId, t.PushWait())
+	if err != nil {
+		return time.Since(start), "", err
+	}
+	err = push.JSON(reqBody, t.Blob.Required, t.Blob.Status, t.Blob.Assertions)
+	if err != nil {
+		// Keep what was pushed in the log, for troubleshooting
+		return time.Since(start), "", fmt.Errorf("%v, body: %s", err, push.Excerpt(reqBody))
+	}
+
+	return time.Since(start), "body: " + push.Excerpt(reqBody), nil
+}
+
+func (t JSONPushTest) Validate() bool {
+	if !t.BaseTest.Validate() {
+		return false
+	}
+	for _, path := range t.Blob.Required {
+		if !push.ValidPath(path) {
+			return false
+		}
+	}
+	if !t.Blob.Status.Validate() {
+		return false
+	}
+	for _, assertion := range t.Blob.Assertions {
+		if !assertion.Validate() {
+			return false
+		}
+	}
+	return true
+}
+
+// LinePushTest receives StatsD and Graphite lines whose metric name starts with the prefix
+type LinePushTest struct {
+	Blob struct {
+		Prefix      string            `json:"prefix"`
+		MetricTests []push.MetricTest `json:"metric_tests"`
+	} `json:"blob"`
+	BaseTest
+}
+
+func (t LinePushTest) RunTest(ctx context.Context, buz *bus.Bus) (time.Duration, error) {
+	start := time.Now()
+	lines, err := nextPush(ctx, buz, t.TestId, t.PushWait())
+	if err != nil {
+		return time.Since(start), err
+	}
+	err = push.Lines(lines, t.Blob.MetricTests)
+
+	return time.Since(start), err
+}
+
+func (t LinePushTest) Validate() bool {
+	if !t.BaseTest.Validate() {
+		return false
+	}
+	if t.Blob.Prefix == "" {
+		return false
+	}
+	for _, metricTest := range t.Blob.MetricTests {
+		if !metricTest.Validate() {
+			return false
+		}
+	}
+	return true
+}
+
 type RequestType string
 
 const (
@@ -503,6 +1186,9 @@ func (t *GenericTest) MaskSensitiveInfo(method RequestType, testDb *GenericTest)
 			}
 			fallthrough
 		case POST:
+			if sshTest.Blob.Credential == "" {
+				break inner // Not set yet, the test is paused
+			}
 			protected := sec.Protected{
 				Plain: sshTest.Blob.Credential,
 			}